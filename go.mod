@@ -4,14 +4,16 @@ go 1.19
 
 require (
 	github.com/gorilla/mux v1.8.0
+	github.com/mattn/go-sqlite3 v1.14.12
+	golang.org/x/crypto v0.14.0
+	gopkg.in/yaml.v3 v3.0.1
 	gorm.io/gorm v1.23.8
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/mattn/go-sqlite3 v1.14.12 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 )
 
 require (
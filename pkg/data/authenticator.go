@@ -1,7 +1,96 @@
 package data
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoStore is returned by the Refreshers lacking the store needed to
+// rotate and revoke tokens, which are then used as plain Authenticators.
+var ErrNoStore = errors.New("no revocation store")
+
 type Authenticator interface {
 	Authenticate(user string, pass string) bool
 	Create(user string) string
 	Use(token string) bool
 }
+
+// Identifier is implemented by the Authenticators able to tell who a token
+// was issued to, used instead of Use when verifying it.
+type Identifier interface {
+	Identify(token string) (*Identity, bool)
+}
+
+// Identity is who a token was issued to, with the roles and tenant granted
+// to it and any other claims it carries. Scopes, when not nil, restrict it
+// to the resource:operation pairs listed, "*" matching any of either.
+type Identity struct {
+	UserID string
+	Roles  []string
+	Tenant string
+	Claims map[string]any
+	Scopes []string
+}
+
+func (i *Identity) HasRole(role string) bool {
+
+	if i == nil {
+		return false
+	}
+
+	for _, item := range i.Roles {
+		if item == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TokenPair is an access token with the refresh token renewing it, and the
+// seconds until the access token expires.
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// Expirer is implemented by the Authenticators whose tokens expire, telling
+// in how long those created by Create do.
+type Expirer interface {
+	ExpiresIn() time.Duration
+}
+
+// Refresher is implemented by the Authenticators issuing token pairs, used
+// instead of Create on login. Refresh trades a refresh token, which cannot
+// be used again, for a new pair and Revoke makes a token of either kind
+// unusable before it expires. RevokePair revokes an access token along with
+// a refresh token, when given, of the same subject.
+type Refresher interface {
+	CreatePair(user string) (TokenPair, error)
+	Refresh(refreshToken string) (TokenPair, error)
+	Revoke(token string) error
+	RevokePair(accessToken string, refreshToken string) error
+}
+
+// RevocationStore keeps the IDs of the revoked tokens until they expire.
+// Revoke tells whether id was revoked already, checking and revoking it at
+// once so that a token cannot be revoked twice by concurrent callers.
+type RevocationStore interface {
+	Revoke(id string, expiresAt time.Time) (alreadyRevoked bool, err error)
+	Revoked(id string) (bool, error)
+}
+
+// AttemptStore counts the login attempts of keys, e.g. users or IPs, and
+// keeps until when they are locked out.
+type AttemptStore interface {
+	// Attempt counts an attempt of key, all forgotten ttl after the last
+	// one, at once with checking its lockout: it returns until when key is
+	// locked out, without counting the attempt, or zero. The nth attempt
+	// counted locks key out for lockout(n), when positive.
+	Attempt(key string, ttl time.Duration, lockout func(attempts int) time.Duration) (time.Time, error)
+	// Refund uncounts an attempt of key, e.g. once it succeeded, lifting
+	// the lockout it may have caused.
+	Refund(key string) error
+	Reset(key string) error
+}
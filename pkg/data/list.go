@@ -0,0 +1,28 @@
+package data
+
+type CountMode string
+
+const (
+	CountNone      CountMode = "none"
+	CountExact     CountMode = "exact"
+	CountEstimated CountMode = "estimated"
+	// CountCapped is only reported back, when counting stopped at the limit
+	CountCapped CountMode = "capped"
+)
+
+func (m CountMode) Valid() bool {
+	return m == CountNone || m == CountExact || m == CountEstimated
+}
+
+type ListOptions struct {
+	// EmptyOK makes an empty result answer 200 with [] instead of 404
+	EmptyOK bool
+	// Count is the counting mode used when the request has no count parameter
+	Count CountMode
+	// CountLimit stops counting after this many rows, 0 means no limit
+	CountLimit int64
+}
+
+type Listable interface {
+	ListOptions() ListOptions
+}
@@ -31,3 +31,41 @@ func VarsInt(ms map[string]string) (map[string]int, error) {
 
 	return mi, nil
 }
+
+var unaccentReplacer = strings.NewReplacer(
+	"À", "A", "Á", "A", "Â", "A", "Ã", "A", "Ä", "A", "Å", "A", "Ā", "A", "Ă", "A", "Ą", "A",
+	"à", "a", "á", "a", "â", "a", "ã", "a", "ä", "a", "å", "a", "ā", "a", "ă", "a", "ą", "a",
+	"Ç", "C", "Ć", "C", "Ĉ", "C", "Ċ", "C", "Č", "C", "ç", "c", "ć", "c", "ĉ", "c", "ċ", "c", "č", "c",
+	"Ď", "D", "Đ", "D", "ď", "d", "đ", "d",
+	"È", "E", "É", "E", "Ê", "E", "Ë", "E", "Ē", "E", "Ĕ", "E", "Ė", "E", "Ę", "E", "Ě", "E",
+	"è", "e", "é", "e", "ê", "e", "ë", "e", "ē", "e", "ĕ", "e", "ė", "e", "ę", "e", "ě", "e",
+	"Ĝ", "G", "Ğ", "G", "Ġ", "G", "Ģ", "G", "ĝ", "g", "ğ", "g", "ġ", "g", "ģ", "g",
+	"Ĥ", "H", "Ħ", "H", "ĥ", "h", "ħ", "h",
+	"Ì", "I", "Í", "I", "Î", "I", "Ï", "I", "Ĩ", "I", "Ī", "I", "Ĭ", "I", "Į", "I", "İ", "I",
+	"ì", "i", "í", "i", "î", "i", "ï", "i", "ĩ", "i", "ī", "i", "ĭ", "i", "į", "i", "ı", "i",
+	"Ĵ", "J", "ĵ", "j", "Ķ", "K", "ķ", "k",
+	"Ĺ", "L", "Ļ", "L", "Ľ", "L", "Ŀ", "L", "Ł", "L", "ĺ", "l", "ļ", "l", "ľ", "l", "ŀ", "l", "ł", "l",
+	"Ñ", "N", "Ń", "N", "Ņ", "N", "Ň", "N", "ñ", "n", "ń", "n", "ņ", "n", "ň", "n",
+	"Ò", "O", "Ó", "O", "Ô", "O", "Õ", "O", "Ö", "O", "Ø", "O", "Ō", "O", "Ŏ", "O", "Ő", "O",
+	"ò", "o", "ó", "o", "ô", "o", "õ", "o", "ö", "o", "ø", "o", "ō", "o", "ŏ", "o", "ő", "o",
+	"Ŕ", "R", "Ŗ", "R", "Ř", "R", "ŕ", "r", "ŗ", "r", "ř", "r",
+	"Ś", "S", "Ŝ", "S", "Ş", "S", "Š", "S", "ś", "s", "ŝ", "s", "ş", "s", "š", "s", "ß", "ss",
+	"Ţ", "T", "Ť", "T", "Ŧ", "T", "ţ", "t", "ť", "t", "ŧ", "t",
+	"Ù", "U", "Ú", "U", "Û", "U", "Ü", "U", "Ũ", "U", "Ū", "U", "Ŭ", "U", "Ů", "U", "Ű", "U", "Ų", "U",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u", "ũ", "u", "ū", "u", "ŭ", "u", "ů", "u", "ű", "u", "ų", "u",
+	"Ŵ", "W", "ŵ", "w", "Ý", "Y", "Ŷ", "Y", "Ÿ", "Y", "ý", "y", "ÿ", "y", "ŷ", "y",
+	"Ź", "Z", "Ż", "Z", "Ž", "Z", "ź", "z", "ż", "z", "ž", "z",
+)
+
+// Unaccent strips the diacritics from the latin letters in str. It can be
+// registered as the unaccent function for accent-insensitive search on SQLite.
+func Unaccent(str string) string {
+	return unaccentReplacer.Replace(str)
+}
+
+// Casefold lowers the case of every letter in str, not only the ascii ones
+// as the lower function of SQLite does. It can be registered as the casefold
+// function for case-insensitive search on SQLite.
+func Casefold(str string) string {
+	return strings.ToLower(str)
+}
@@ -20,6 +20,19 @@ type DeleteValidator interface {
 	ValidateDelete(ctx context.Context) error
 }
 
+// ReadValidator guards reading a row, e.g. when it is referenced by
+// another one.
+type ReadValidator interface {
+	ValidateRead(ctx context.Context) error
+}
+
+// LinkValidator guards linking and unlinking the items of type T to the
+// many to many relation of its implementer.
+type LinkValidator[T any] interface {
+	ValidateLink(ctx context.Context, obj T) error
+	ValidateUnlink(ctx context.Context, obj T) error
+}
+
 type Validate[T any] struct {
 }
 
@@ -35,9 +48,32 @@ func (*Validate[T]) ValidateDelete(ctx context.Context) error {
 	return nil
 }
 
+type LinkValidate[T any] struct {
+}
+
+func (*LinkValidate[T]) ValidateLink(ctx context.Context, obj T) error {
+	return nil
+}
+
+func (*LinkValidate[T]) ValidateUnlink(ctx context.Context, obj T) error {
+	return nil
+}
+
+// CodeInvalidReference is the code of the errors of fields referring to
+// rows that do not exist or cannot be read.
+const CodeInvalidReference = 1001
+
+// CodeReadOnly is the code of the errors of fields that cannot be changed.
+const CodeReadOnly = 1002
+
+// CodeWeakPassword is the code of the errors of passwords failing the
+// password policy.
+const CodeWeakPassword = 1003
+
 type ValidationError struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
 }
 
 func (e ValidationError) Error() string {
@@ -51,7 +87,11 @@ func (e ValidationError) Error() string {
 }
 
 func ValidationErrorNew(code int, message string) ValidationError {
-	return ValidationError{code, message}
+	return ValidationError{Code: code, Message: message}
+}
+
+func FieldValidationErrorNew(field string, code int, message string) ValidationError {
+	return ValidationError{Code: code, Message: message, Field: field}
 }
 
 func Valid(str string) bool {
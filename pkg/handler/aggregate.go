@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var matchAggregation = regexp.MustCompile(`^(count|sum|avg|min|max)\((\*|[A-Za-z0-9_]+)\)$`)
+
+type aggregation struct {
+	function string
+	field    *schema.Field
+	alias    string
+}
+
+func isNumeric(field *schema.Field) bool {
+
+	switch field.IndirectFieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	typeName := field.FieldType.Name()
+
+	return strings.HasPrefix(typeName, "NullInt") || strings.HasPrefix(typeName, "NullFloat")
+}
+
+// parseAggregations parses expressions like sum(amount) or count(*), the
+// fields named by their JSON or Go names, into the columns they aggregate.
+func parseAggregations(s *schema.Schema, queries []string) ([]aggregation, error) {
+
+	if len(queries) == 0 {
+		queries = []string{"count(*)"}
+	}
+
+	var aggregations []aggregation
+
+	for _, query := range queries {
+
+		match := matchAggregation.FindStringSubmatch(strings.ToLower(strings.ReplaceAll(query, " ", "")))
+		if match == nil {
+			return nil, errors.New("invalid aggregation")
+		}
+
+		if match[2] == "*" {
+			if match[1] != "count" {
+				return nil, errors.New("invalid aggregation")
+			}
+			aggregations = append(aggregations, aggregation{function: "count", alias: "count"})
+			continue
+		}
+
+		// the match was lowered, so look the field up in the original query
+		name := query[strings.Index(query, "(")+1 : strings.LastIndex(query, ")")]
+
+		field := lookupField(s, strings.TrimSpace(name))
+		if field == nil {
+			return nil, errors.New("inexistent aggregation field")
+		}
+
+		if (match[1] == "sum" || match[1] == "avg") && !isNumeric(field) {
+			return nil, errors.New("aggregation of non numeric field")
+		}
+
+		aggregations = append(aggregations, aggregation{function: match[1], field: field, alias: match[1] + "_" + jsonName(field)})
+	}
+
+	return aggregations, nil
+}
+
+// groupQuery selects the group_by fields and the aggregations of query over
+// the rows filtered by db.
+func groupQuery(db *gorm.DB, groups []*schema.Field, aggregations []aggregation) *gorm.DB {
+
+	var selects []string
+	var vars []any
+
+	var columns []clause.Column
+	var orders []clause.OrderByColumn
+
+	for _, field := range groups {
+
+		column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+		selects = append(selects, "? AS ?")
+		vars = append(vars, column, clause.Column{Name: jsonName(field)})
+
+		columns = append(columns, column)
+		orders = append(orders, clause.OrderByColumn{Column: column})
+	}
+
+	for _, aggregation := range aggregations {
+
+		if aggregation.field == nil {
+			selects = append(selects, "COUNT(*) AS ?")
+			vars = append(vars, clause.Column{Name: aggregation.alias})
+			continue
+		}
+
+		selects = append(selects, fmt.Sprintf("%s(?) AS ?", strings.ToUpper(aggregation.function)))
+		vars = append(vars, clause.Column{Table: clause.CurrentTable, Name: aggregation.field.DBName}, clause.Column{Name: aggregation.alias})
+	}
+
+	db = db.Select(strings.Join(selects, ", "), vars...)
+
+	if len(columns) > 0 {
+		db = db.Clauses(clause.GroupBy{Columns: columns}, clause.OrderBy{Columns: orders})
+	}
+
+	return db
+}
+
+// typedValue gives value, as scanned from the column of field, the type of
+// the field, e.g. turning into a boolean the integer SQLite stores it as.
+func typedValue(ctx context.Context, s *schema.Schema, field *schema.Field, value any) any {
+
+	obj := reflect.New(s.ModelType).Elem()
+
+	if field.Set(ctx, obj, value) != nil {
+		return value
+	}
+
+	return field.ReflectValueOf(ctx, obj).Interface()
+}
+
+// Aggregate responds with the aggregations given as agg, e.g.
+// ?agg=sum(amount),count(*), of the rows of T matching the same filters as
+// List, grouped by the fields in group_by.
+func Aggregate[T any](w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[T](w, r, OpList) {
+		return
+	}
+
+	where, err := whereVars[T](r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	URLQuery := r.URL.Query()
+
+	var obj T
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var groups []*schema.Field
+	for _, name := range queryList(URLQuery["group_by"]) {
+
+		field := lookupField(s, name)
+		if field == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		groups = append(groups, field)
+	}
+
+	aggregations, err := parseAggregations(s, queryList(URLQuery["agg"]))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	offset, limit, err := pagingParams(URLQuery)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	innerDb, err := filterQuery(ownerScope[T](r)(db), where, URLQuery, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rows := []map[string]any{}
+
+	res := groupQuery(innerDb, groups, aggregations).Offset(offset).Limit(limit).Find(&rows)
+	if res.Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for _, row := range rows {
+		for _, field := range groups {
+			row[jsonName(field)] = typedValue(r.Context(), s, field, row[jsonName(field)])
+		}
+	}
+
+	w.Header().Add("X-Paging-Size", fmt.Sprint(len(rows)))
+
+	bytes, err := marshalFields(rows, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	fmt.Fprintf(w, "%v", string(bytes))
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateCount(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/aggregate/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `[{"count":5}]`, rec.Body.String())
+}
+
+func TestAggregateGroupBy(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	req, err := http.NewRequest("GET", "/article/aggregate/?group_by=Draft&agg=count(*),sum(id_article),max(title),avg(ID)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-Paging-Size"))
+	assert.Equal(t, `[{"avg_id_article":2,"count":2,"draft":false,"max_title":"gorm search","sum_id_article":4},{"avg_id_article":2,"count":1,"draft":true,"max_title":"routing","sum_id_article":2}]`, rec.Body.String())
+}
+
+func TestAggregateSearch(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	req, err := http.NewRequest("GET", "/article/aggregate/?search=golang&search_fields=title,body&group_by=draft", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"count":1,"draft":false},{"count":1,"draft":true}]`, rec.Body.String())
+}
+
+func TestAggregateSub(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/3/subdummy/aggregate/?group_by=id_dummy&agg=count(*),min(id_subdummy)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"count":2,"id_dummy":3,"min_id_subdummy":5}]`, rec.Body.String())
+
+	req, err = http.NewRequest("GET", "/dummy/30/subdummy/aggregate/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAggregateBadRequest(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	for _, query := range []string{"group_by=wrong", "agg=sum(title)", "agg=sum(*)", "agg=median(id_dummy)", "agg=count(wrong)", "agg=count(id_dummy)&limit=0"} {
+
+		req, err := http.NewRequest("GET", "/dummy/aggregate/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/diogomattioli/crud/pkg/data"
+)
+
+// APIKey lets services call the API without logging in, acting as Owner
+// with Roles, restricted to Scopes, so a key without any is allowed
+// nothing. Only a hash of the secret part of the key is stored, the key
+// itself being answered once by CreateAPIKey.
+type APIKey struct {
+	ID         int        `json:"id_api_key" gorm:"primaryKey"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix" gorm:"uniqueIndex"`
+	Hash       string     `json:"-" crud:"nosearch"`
+	Owner      string     `json:"owner" crud:"owner"`
+	Tenant     string     `json:"tenant"`
+	Roles      []string   `json:"roles" gorm:"serializer:json"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// apiKeyPrefix starts the keys, telling them apart from other tokens.
+const apiKeyPrefix = "crud_"
+
+// lastUsedInterval bounds how often the last use of a key is written.
+const lastUsedInterval = time.Minute
+
+var apiKeyExtractors = []TokenExtractor{HeaderToken("X-API-Key")}
+
+// SetAPIKeyExtractors sets the extractors tried in order for the API key
+// of the requests, the X-API-Key header only by default.
+func SetAPIKeyExtractors(_extractors ...TokenExtractor) {
+	apiKeyExtractors = _extractors
+}
+
+func (k *APIKey) GetID() int {
+	return k.ID
+}
+
+// validateScopes requires valid scopes, covered by those of identity when
+// it is restricted to any.
+func (k *APIKey) validateScopes(identity *data.Identity) error {
+
+	for _, scope := range k.Scopes {
+
+		resource, op, ok := strings.Cut(scope, ":")
+		if !ok || resource == "" || (op != "*" && !Operation(op).Valid()) {
+			return data.FieldValidationErrorNew("scopes", 1, fmt.Sprintf("Invalid scope %s", scope))
+		}
+
+		if identity != nil && identity.Scopes != nil && !scopeAllows(identity.Scopes, resource, Operation(op)) {
+			return data.FieldValidationErrorNew("scopes", 1, fmt.Sprintf("Scope %s is not held", scope))
+		}
+	}
+
+	return nil
+}
+
+// ValidateCreate requires a name, valid scopes within those of the
+// requester, when restricted, and roles held by the requester, unless an
+// admin, so keys grant no more than their creators.
+func (k *APIKey) ValidateCreate(ctx context.Context) error {
+
+	if !data.Valid(k.Name) {
+		return data.FieldValidationErrorNew("name", 1, "Name is required")
+	}
+
+	session, _ := SessionFrom(ctx)
+
+	if !session.Identity.HasRole(adminRole) {
+		for _, role := range k.Roles {
+			if !session.Identity.HasRole(role) {
+				return data.FieldValidationErrorNew("roles", 1, fmt.Sprintf("Role %s is not held", role))
+			}
+		}
+	}
+
+	return k.validateScopes(session.Identity)
+}
+
+func (k *APIKey) ValidateUpdate(ctx context.Context, old *APIKey) error {
+
+	if k.Prefix != old.Prefix {
+		return data.FieldValidationErrorNew("prefix", data.CodeReadOnly, "Prefix cannot be changed")
+	}
+
+	if k.Tenant != old.Tenant && !IsAdmin(ctx) {
+		return data.FieldValidationErrorNew("tenant", data.CodeReadOnly, "Tenant can only be changed by an admin")
+	}
+
+	return k.ValidateCreate(ctx)
+}
+
+func (k *APIKey) ValidateDelete(ctx context.Context) error {
+	return nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// newAPIKey returns a key, made of a prefix to look it up by and a secret,
+// and the prefix and hash of the secret to store.
+func newAPIKey() (string, string, string, error) {
+
+	bytes := make([]byte, 40)
+
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	prefix := hex.EncodeToString(bytes[:8])
+	secret := hex.EncodeToString(bytes[8:])
+
+	return apiKeyPrefix + prefix + "_" + secret, prefix, hashSecret(secret), nil
+}
+
+// verifyAPIKey returns the stored key matching key, unless expired,
+// recording its use.
+func verifyAPIKey(key string) (*APIKey, bool) {
+
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !ok || !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, false
+	}
+
+	var stored APIKey
+
+	res := db.Where("prefix = ?", prefix).Limit(1).Find(&stored)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(stored.Hash), []byte(hashSecret(secret))) != 1 {
+		return nil, false
+	}
+
+	now := time.Now()
+
+	if stored.ExpiresAt != nil && !now.Before(*stored.ExpiresAt) {
+		return nil, false
+	}
+
+	if stored.LastUsedAt == nil || now.Sub(*stored.LastUsedAt) >= lastUsedInterval {
+		db.Model(&stored).UpdateColumn("last_used_at", now)
+		stored.LastUsedAt = &now
+	}
+
+	return &stored, true
+}
+
+// APIKeyResponse is the body answered by CreateAPIKey, the only time the
+// key is revealed.
+type APIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKey creates an API key owned by the requester, as Create does,
+// answering it with the key. The keys are otherwise managed with the CRUD
+// handlers, e.g. List[APIKey] and Delete[*APIKey], which only reach those
+// of the requester through their owner field.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[APIKey](w, r, OpCreate) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if r.Body == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var obj APIKey
+
+	err = json.Unmarshal(body, &obj)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	ctx := sessionContext(r)
+
+	err = setOwner(ctx, &obj)
+	if err != nil {
+		writeProblem(w, http.StatusForbidden, "an identity is required to own the item")
+		return
+	}
+
+	// keys belong to the tenant of their creators, unless set by an admin
+	if obj.Tenant == "" || !IsAdmin(ctx) {
+		session, _ := SessionFrom(ctx)
+		obj.Tenant = session.Identity.Tenant
+	}
+
+	err = obj.ValidateCreate(ctx)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	key, prefix, hash, err := newAPIKey()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	obj.ID = 0
+	obj.Prefix = prefix
+	obj.Hash = hash
+	obj.LastUsedAt = nil
+
+	res := db.Create(&obj)
+	if res.RowsAffected == 0 {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%+v%+v", r.URL.RequestURI(), obj.ID))
+	w.Header().Set("X-Item-ID", fmt.Sprintf("%+v", obj.ID))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	w.WriteHeader(http.StatusCreated)
+
+	json.NewEncoder(w).Encode(APIKeyResponse{APIKey: obj, Key: key})
+}
+
+// AuthWithAPIKeys lets through the requests with a valid API key, found
+// by the API key extractors, as Auth does for those with a token, storing
+// a session whose identity is the owner of the key with its roles and
+// scopes. Requests without an API key are left to Auth.
+func AuthWithAPIKeys(next http.Handler) http.Handler {
+
+	withToken := Auth(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var key string
+
+		for _, extractor := range apiKeyExtractors {
+			if key = extractor(r); key != "" {
+				break
+			}
+		}
+
+		if key == "" {
+			withToken.ServeHTTP(w, r)
+			return
+		}
+
+		stored, ok := verifyAPIKey(key)
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		scopes := stored.Scopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+
+		identity := &data.Identity{
+			UserID: stored.Owner,
+			Roles:  stored.Roles,
+			Tenant: stored.Tenant,
+			Claims: map[string]any{"api_key": stored.ID},
+			Scopes: scopes,
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), Session{}, Session{Identity: identity})))
+	})
+}
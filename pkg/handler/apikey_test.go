@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupAPIKeys(t *testing.T, keys ...APIKey) []string {
+
+	db.AutoMigrate(&APIKey{})
+
+	var secrets []string
+
+	for _, key := range keys {
+
+		secret, prefix, hash, err := newAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		key.Prefix = prefix
+		key.Hash = hash
+
+		db.Create(&key)
+
+		secrets = append(secrets, secret)
+	}
+
+	return secrets
+}
+
+func TestCreateAPIKey(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupAPIKeys(t)
+
+	req, err := http.NewRequest("POST", "/keys/api_key/", strings.NewReader("{\"name\":\"batch\",\"roles\":[\"reader\"],\"scopes\":[\"dummies:list\"],\"owner\":\"b\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec := serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	var response APIKeyResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+
+	assert.Equal(t, true, strings.HasPrefix(response.Key, "crud_"+response.Prefix+"_"))
+	assert.Equal(t, "batch", response.Name)
+	assert.Equal(t, "a", response.Owner)
+
+	var stored APIKey
+	db.First(&stored, 1)
+
+	assert.Equal(t, "a", stored.Owner)
+	assert.Equal(t, []string{"dummies:list"}, stored.Scopes)
+	assert.NotContains(t, stored.Hash, strings.Split(response.Key, "_")[2])
+
+	for _, body := range []string{
+		"{\"name\":\"batch\",\"roles\":[\"admin\"]}",
+		"{\"name\":\"batch\",\"scopes\":[\"dummies:remove\"]}",
+		"{\"name\":\"batch\",\"scopes\":[\"dummies\"]}",
+		"{\"scopes\":[\"dummies:list\"]}",
+	} {
+
+		req, err := http.NewRequest("POST", "/keys/api_key/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Access-Token", "123-token")
+
+		rec := serveHTTPKeys(req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code, body)
+	}
+}
+
+func TestCreateAPIKeyScoped(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	keys := setupAPIKeys(t, APIKey{Name: "issuer", Owner: "a", Scopes: []string{"api_keys:create", "dummies:list"}})
+
+	for body, code := range map[string]int{
+		"{\"name\":\"batch\",\"scopes\":[\"*:*\"]}":            http.StatusUnprocessableEntity,
+		"{\"name\":\"batch\",\"scopes\":[\"dummies:*\"]}":      http.StatusUnprocessableEntity,
+		"{\"name\":\"batch\",\"scopes\":[\"dummies:create\"]}": http.StatusUnprocessableEntity,
+		"{\"name\":\"batch\",\"scopes\":[\"dummies:list\"]}":   http.StatusCreated,
+	} {
+
+		req, err := http.NewRequest("POST", "/keys/api_key/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", keys[0])
+
+		rec := serveHTTPKeys(req)
+
+		assert.Equal(t, code, rec.Code, body)
+	}
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+
+	SetAuthenticator(&MockAuth{})
+
+	setupDb(1)
+	defer destroyDb()
+
+	expired := time.Now().Add(-time.Hour)
+
+	keys := setupAPIKeys(t,
+		APIKey{Name: "batch", Owner: "a", Roles: []string{"reader"}, Scopes: []string{"dummies:list"}},
+		APIKey{Name: "old", Owner: "a", Scopes: []string{"*:*"}, ExpiresAt: &expired},
+	)
+
+	req, err := http.NewRequest("GET", "/keys/dummy/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-API-Key", keys[0])
+
+	rec := serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var stored APIKey
+	db.First(&stored, 1)
+
+	assert.NotNil(t, stored.LastUsedAt)
+
+	req, err = http.NewRequest("GET", "/keys/session/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-API-Key", keys[0])
+
+	rec = serveHTTPKeys(req)
+
+	var session Session
+	json.NewDecoder(rec.Body).Decode(&session)
+
+	assert.Equal(t, "a", session.Identity.UserID)
+	assert.Equal(t, []string{"reader"}, session.Identity.Roles)
+	assert.Equal(t, []string{"dummies:list"}, session.Identity.Scopes)
+
+	req, err = http.NewRequest("GET", "/keys/dummy/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-API-Key", keys[0])
+
+	rec = serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+
+	for _, key := range []string{keys[1], keys[0] + "0", "crud_wrong", "wrong"} {
+
+		req, err := http.NewRequest("GET", "/keys/dummy/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("X-API-Key", key)
+
+		rec := serveHTTPKeys(req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code, key)
+	}
+
+	req, err = http.NewRequest("GET", "/keys/dummy/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec = serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAPIKeyTenant(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	keys := setupAPIKeys(t, APIKey{Name: "other", Owner: "c", Tenant: "u"})
+
+	req, err := http.NewRequest("POST", "/keys/api_key/", strings.NewReader("{\"name\":\"batch\",\"tenant\":\"u\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec := serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var response APIKeyResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+
+	assert.Equal(t, "t", response.Tenant)
+
+	for key, code := range map[string]int{
+		response.Key: http.StatusOK,
+		keys[0]:      http.StatusForbidden,
+	} {
+
+		req, err := http.NewRequest("GET", "/keys/tenant/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("X-API-Key", key)
+
+		rec := serveHTTPKeys(req)
+
+		assert.Equal(t, code, rec.Code)
+	}
+
+	req, err = http.NewRequest("PATCH", fmt.Sprintf("/keys/api_key/%v", response.ID), strings.NewReader("{\"tenant\":\"u\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec = serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+}
+
+func TestAPIKeyManagement(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupAPIKeys(t,
+		APIKey{Name: "first", Owner: "a", Scopes: []string{"*:*"}},
+		APIKey{Name: "second", Owner: "b", Scopes: []string{"*:*"}},
+	)
+
+	req, err := http.NewRequest("GET", "/keys/api_key/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec := serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var slice []map[string]any
+	json.NewDecoder(rec.Body).Decode(&slice)
+
+	assert.Equal(t, 1, len(slice))
+	assert.Equal(t, "first", slice[0]["name"])
+	assert.NotContains(t, slice[0], "Hash")
+
+	req, err = http.NewRequest("PATCH", "/keys/api_key/1", strings.NewReader("{\"prefix\":\"other\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec = serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	req, err = http.NewRequest("DELETE", "/keys/api_key/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec = serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req, err = http.NewRequest("DELETE", "/keys/api_key/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec = serveHTTPKeys(req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestAPIKeyHiddenFields(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupAPIKeys(t, APIKey{Name: "first", Owner: "a", Scopes: []string{"*:*"}})
+
+	for url, code := range map[string]int{
+		"/keys/api_key/facet/?facet=name":                http.StatusOK,
+		"/keys/api_key/facet/?facet=Hash":                http.StatusBadRequest,
+		"/keys/api_key/facet/?facet=name&filter[Hash]=x": http.StatusBadRequest,
+		"/keys/api_key/aggregate/?agg=max(Hash)":         http.StatusBadRequest,
+		"/keys/api_key/aggregate/?group_by=Hash":         http.StatusBadRequest,
+		"/keys/api_key/?fields=Hash":                     http.StatusBadRequest,
+		"/keys/api_key/?search=x&search_fields=Hash":     http.StatusBadRequest,
+	} {
+
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("X-Access-Token", "123-token")
+
+		rec := serveHTTPKeys(req)
+
+		assert.Equal(t, code, rec.Code, url)
+		assert.NotContains(t, rec.Body.String(), "hash", url)
+	}
+}
+
+func serveHTTPKeys(req *http.Request) *httptest.ResponseRecorder {
+
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter().StrictSlash(true)
+	subrouter := router.PathPrefix("/keys").Subrouter()
+	subrouter.Use(AuthWithAPIKeys)
+	subrouter.HandleFunc("/api_key/", List[APIKey]).Methods("GET")
+	subrouter.HandleFunc("/api_key/facet/", Facet[APIKey]).Methods("GET")
+	subrouter.HandleFunc("/api_key/aggregate/", Aggregate[APIKey]).Methods("GET")
+	subrouter.HandleFunc("/api_key/", CreateAPIKey).Methods("POST")
+	subrouter.HandleFunc("/api_key/{id_api_key:[0-9]+}", Update[*APIKey]).Methods("PATCH")
+	subrouter.HandleFunc("/api_key/{id_api_key:[0-9]+}", Delete[*APIKey]).Methods("DELETE")
+	subrouter.HandleFunc("/dummy/", List[Dummy]).Methods("GET")
+	subrouter.HandleFunc("/dummy/{id_dummy:[0-9]+}", Retrieve[Dummy]).Methods("GET")
+	// allows only the requesters of tenant t
+	subrouter.HandleFunc("/tenant/", func(w http.ResponseWriter, r *http.Request) {
+		session, _ := SessionFrom(r.Context())
+		if session.Identity == nil || session.Identity.Tenant != "t" {
+			writeProblem(w, http.StatusForbidden, "another tenant")
+		}
+	}).Methods("GET")
+	subrouter.HandleFunc("/session/", func(w http.ResponseWriter, r *http.Request) {
+		session, _ := SessionFrom(r.Context())
+		json.NewEncoder(w).Encode(session)
+	}).Methods("GET")
+	router.ServeHTTP(rec, req)
+
+	return rec
+}
@@ -1,8 +1,13 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/diogomattioli/crud/pkg/data"
 )
@@ -13,42 +18,238 @@ func SetAuthenticator(_auth data.Authenticator) {
 	auth = _auth
 }
 
+// LoginResponse is the body answered by Login and Refresh, along with the
+// token headers.
+type LoginResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// credentials reads the user and pass of a multipart, urlencoded or JSON
+// login body, returning the status to answer when it cannot: 415 for other
+// media types and 400 for malformed JSON.
+func credentials(r *http.Request) (string, string, int) {
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	switch mediaType {
+	case "multipart/form-data", "application/x-www-form-urlencoded":
+		return r.PostFormValue("user"), r.PostFormValue("pass"), 0
+	case "application/json":
+		var body struct {
+			User string `json:"user"`
+			Pass string `json:"pass"`
+		}
+		if r.Body == nil || json.NewDecoder(r.Body).Decode(&body) != nil {
+			return "", "", http.StatusBadRequest
+		}
+		return body.User, body.Pass, 0
+	}
+
+	return "", "", http.StatusUnsupportedMediaType
+}
+
 func Login(w http.ResponseWriter, r *http.Request) {
 
-	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
-		w.WriteHeader(http.StatusUnsupportedMediaType)
+	user, pass, status := credentials(r)
+	if status != 0 {
+		w.WriteHeader(status)
 		return
 	}
 
-	user := r.FormValue("user")
-	pass := r.FormValue("pass")
-
 	if user == "" || pass == "" {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
+	if throttle != nil {
+
+		until, err := throttle.attempt(r, user)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if !until.IsZero() {
+			writeLocked(w, until)
+			return
+		}
+	}
+
 	if !auth.Authenticate(user, pass) {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
 
+	if throttle != nil && throttle.succeed(r, user) != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if refresher, ok := auth.(data.Refresher); ok {
+
+		pair, err := refresher.CreatePair(user)
+		if err == nil {
+			writePair(w, pair)
+			return
+		}
+
+		// without a store a single token is issued, as by any authenticator
+		if !errors.Is(err, data.ErrNoStore) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// an empty token is one that could not be signed
 	token := auth.Create(user)
+	if token == "" {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	response := LoginResponse{AccessToken: token, TokenType: "Bearer"}
 
 	w.Header().Set("X-Access-Token", token)
+
+	if expirer, ok := auth.(data.Expirer); ok {
+		response.ExpiresIn = int64(expirer.ExpiresIn() / time.Second)
+		w.Header().Set("X-Expires-In", fmt.Sprint(response.ExpiresIn))
+	}
+
+	writeLogin(w, response)
+}
+
+func writePair(w http.ResponseWriter, pair data.TokenPair) {
+
+	w.Header().Set("X-Access-Token", pair.AccessToken)
+	w.Header().Set("X-Refresh-Token", pair.RefreshToken)
+	w.Header().Set("X-Expires-In", fmt.Sprint(pair.ExpiresIn))
+
+	writeLogin(w, LoginResponse{AccessToken: pair.AccessToken, TokenType: "Bearer", ExpiresIn: pair.ExpiresIn, RefreshToken: pair.RefreshToken})
+}
+
+// writeLogin writes response, setting the token cookie when configured.
+func writeLogin(w http.ResponseWriter, response LoginResponse) {
+
+	err := setTokenCookies(w, response.AccessToken, int(response.ExpiresIn))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// tokens must not be kept by caches
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// Refresh trades the refresh token of the X-Refresh-Token header for a new
+// token pair, when the authenticator is a data.Refresher.
+func Refresh(w http.ResponseWriter, r *http.Request) {
+
+	refresher, ok := auth.(data.Refresher)
+	if !ok {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	token := r.Header.Get("X-Refresh-Token")
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	pair, err := refresher.Refresh(token)
+	if errors.Is(err, data.ErrNoStore) {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	writePair(w, pair)
+}
+
+// Logout revokes the token of the request and the one of the
+// X-Refresh-Token header, when given and of the same subject, if the
+// authenticator is a data.Refresher with a store, and clears the token
+// cookie when configured.
+func Logout(w http.ResponseWriter, r *http.Request) {
+
+	refresher, ok := auth.(data.Refresher)
+	if !ok {
+		logoutCookie(w)
+		return
+	}
+
+	token := requestToken(r)
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err := refresher.RevokePair(token, r.Header.Get("X-Refresh-Token"))
+	if errors.Is(err, data.ErrNoStore) {
+		logoutCookie(w)
+		return
+	}
+
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	clearTokenCookies(w)
+
+	w.WriteHeader(http.StatusNoContent)
 }
 
+// logoutCookie logs out when there is nothing to revoke, only clearing the
+// token cookie when configured.
+func logoutCookie(w http.ResponseWriter) {
+
+	if cookieConfig == nil {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+
+	clearTokenCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Auth lets through the requests whose token, found by the token
+// extractors, the authenticator verifies, storing their session, with the
+// identity when it tells one, in the request context.
 func Auth(next http.Handler) http.Handler {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		token := r.Header.Get("X-Access-Token")
+		token := requestToken(r)
+
+		session := Session{Token: token}
+
+		if identifier, ok := auth.(data.Identifier); ok {
+
+			identity, ok := identifier.Identify(token)
+			if !ok {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			session.Identity = identity
 
-		if !auth.Use(token) {
+		} else if !auth.Use(token) {
 			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), Session{}, session)))
 	})
 }
@@ -2,10 +2,17 @@ package handler
 
 import (
 	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/diogomattioli/crud/pkg/data"
+	"github.com/diogomattioli/crud/pkg/jwt"
 	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
@@ -119,13 +126,184 @@ func TestLoginNotFormData(t *testing.T) {
 
 	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
 
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", "text/plain")
 
 	rec = serveHTTPAuth(req)
 
 	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
 }
 
+func TestLoginJSON(t *testing.T) {
+
+	SetAuthenticator(&MockAuth{})
+
+	req, err := http.NewRequest("POST", "/login/", strings.NewReader("{\"user\":\"a\",\"pass\":\"a\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "123-token", rec.Header().Get("X-Access-Token"))
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	assert.Equal(t, "{\"access_token\":\"123-token\",\"token_type\":\"Bearer\"}\n", rec.Body.String())
+
+	req, err = http.NewRequest("POST", "/login/", strings.NewReader("{\"user\":\"a\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	for _, body := range []string{"user=a&pass=a", "{\"user\":\"a\",\"pass\":\"a\"", "{\"user\":\"a\",\"pass\":1}"} {
+
+		req, err = http.NewRequest("POST", "/login/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		rec = serveHTTPAuth(req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+}
+
+type MockExpirer struct {
+	MockAuth
+}
+
+func (a MockExpirer) ExpiresIn() time.Duration {
+	return 15 * time.Minute
+}
+
+func TestLoginJWTWithoutStore(t *testing.T) {
+
+	a := &jwt.Authenticator{
+		Keys:  []jwt.Key{jwt.HS256("", []byte("secret"))},
+		Check: func(user string, pass string) bool { return true },
+	}
+
+	SetAuthenticator(a)
+	defer SetAuthenticator(&MockAuth{})
+
+	req, err := http.NewRequest("POST", "/login/", strings.NewReader("{\"user\":\"a\",\"pass\":\"a\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response LoginResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+
+	assert.Equal(t, true, a.Use(response.AccessToken))
+	assert.Equal(t, int64(900), response.ExpiresIn)
+	assert.Equal(t, "", response.RefreshToken)
+
+	req, err = http.NewRequest("POST", "/refresh/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Refresh-Token", response.AccessToken)
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestLoginJWTVerifyOnly(t *testing.T) {
+
+	public, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetAuthenticator(&jwt.Authenticator{
+		Keys:  []jwt.Key{jwt.EdDSA("", nil, public), jwt.HS256("", []byte("secret"))},
+		Check: func(user string, pass string) bool { return true },
+	})
+	defer SetAuthenticator(&MockAuth{})
+
+	req, err := http.NewRequest("POST", "/login/", strings.NewReader("{\"user\":\"a\",\"pass\":\"a\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "", rec.Header().Get("X-Access-Token"))
+}
+
+func TestLoginExpiresIn(t *testing.T) {
+
+	SetAuthenticator(&MockExpirer{})
+	defer SetAuthenticator(&MockAuth{})
+
+	req, err := http.NewRequest("POST", "/login/", strings.NewReader("{\"user\":\"a\",\"pass\":\"a\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "900", rec.Header().Get("X-Expires-In"))
+	assert.Equal(t, "{\"access_token\":\"123-token\",\"token_type\":\"Bearer\",\"expires_in\":900}\n", rec.Body.String())
+}
+
+func TestLoginUrlencoded(t *testing.T) {
+
+	SetAuthenticator(&MockAuth{})
+
+	req, err := http.NewRequest("POST", "/login/", strings.NewReader("user=a&pass=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "123-token", rec.Header().Get("X-Access-Token"))
+
+	var response LoginResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+
+	assert.Equal(t, LoginResponse{AccessToken: "123-token", TokenType: "Bearer"}, response)
+
+	req, err = http.NewRequest("POST", "/login/?pass=a", strings.NewReader("user=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
 func TestAuthListOk(t *testing.T) {
 
 	SetAuthenticator(&MockAuth{})
@@ -181,15 +359,204 @@ func TestAuthEmpty(t *testing.T) {
 	assert.Equal(t, http.StatusForbidden, rec.Code)
 }
 
+func TestAuthSession(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	req, err := http.NewRequest("GET", "/auth/session/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var session Session
+	json.NewDecoder(rec.Body).Decode(&session)
+
+	assert.Equal(t, "123-token", session.Token)
+	assert.Equal(t, &data.Identity{UserID: "a", Roles: []string{"reader"}, Tenant: "t", Claims: map[string]any{"sub": "a"}}, session.Identity)
+
+	req.Header.Set("X-Access-Token", "token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestAuthSessionValidator(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	req, err := http.NewRequest("POST", "/auth/dummy/", strings.NewReader("{\"title\":\"title\",\"valid\":true}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "{\"code\":1,\"message\":\"Reader - a\"}", rec.Body.String())
+}
+
+func TestLoginPair(t *testing.T) {
+
+	SetAuthenticator(&MockRefresher{})
+	defer SetAuthenticator(&MockAuth{})
+
+	body, header, err := formData(map[string]string{"user": "a", "pass": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "/login/", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", header)
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "a-access", rec.Header().Get("X-Access-Token"))
+	assert.Equal(t, "a-refresh", rec.Header().Get("X-Refresh-Token"))
+	assert.Equal(t, "900", rec.Header().Get("X-Expires-In"))
+
+	var response LoginResponse
+	json.NewDecoder(rec.Body).Decode(&response)
+
+	assert.Equal(t, LoginResponse{AccessToken: "a-access", TokenType: "Bearer", ExpiresIn: 900, RefreshToken: "a-refresh"}, response)
+}
+
+func TestRefresh(t *testing.T) {
+
+	refresher := &MockRefresher{}
+
+	SetAuthenticator(refresher)
+	defer SetAuthenticator(&MockAuth{})
+
+	req, err := http.NewRequest("POST", "/refresh/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req.Header.Set("X-Refresh-Token", "a-refresh")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "a-access", rec.Header().Get("X-Access-Token"))
+	assert.Equal(t, "a-refresh", rec.Header().Get("X-Refresh-Token"))
+
+	refresher.revoked = []string{"a-refresh"}
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	SetAuthenticator(&MockAuth{})
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNotImplemented, rec.Code)
+}
+
+func TestLogout(t *testing.T) {
+
+	refresher := &MockRefresher{}
+
+	SetAuthenticator(refresher)
+	defer SetAuthenticator(&MockAuth{})
+
+	req, err := http.NewRequest("POST", "/logout/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	req.Header.Set("X-Access-Token", "a-access")
+	req.Header.Set("X-Refresh-Token", "b-refresh")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, 0, len(refresher.revoked))
+
+	req.Header.Set("X-Refresh-Token", "a-refresh")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, []string{"a-access", "a-refresh"}, refresher.revoked)
+
+	req, err = http.NewRequest("GET", "/auth/dummy/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Access-Token", "a-access")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req, err = http.NewRequest("POST", "/logout/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("X-Access-Token", "wrong")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
 func serveHTTPAuth(req *http.Request) *httptest.ResponseRecorder {
 
 	rec := httptest.NewRecorder()
 
 	router := mux.NewRouter().StrictSlash(true)
 	router.HandleFunc("/login/", Login).Methods("POST")
+	router.HandleFunc("/refresh/", Refresh).Methods("POST")
+	router.HandleFunc("/logout/", Logout).Methods("POST")
 	subrouter := router.PathPrefix("/auth").Subrouter()
 	subrouter.Use(Auth)
 	subrouter.HandleFunc("/dummy/", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	subrouter.HandleFunc("/dummy/", Create[*Dummy]).Methods("POST")
+	subrouter.HandleFunc("/dummy/{id_dummy:[0-9]+}", Retrieve[Dummy]).Methods("GET")
+	subrouter.HandleFunc("/dummy/{id_dummy:[0-9]+}", Delete[*Dummy]).Methods("DELETE")
+	subrouter.HandleFunc("/memo/", List[Memo]).Methods("GET")
+	subrouter.HandleFunc("/memo/", Create[*Memo]).Methods("POST")
+	subrouter.HandleFunc("/memo/{id_memo:[0-9]+}", Retrieve[Memo]).Methods("GET")
+	subrouter.HandleFunc("/memo/{id_memo:[0-9]+}", Update[*Memo]).Methods("PATCH")
+	subrouter.HandleFunc("/memo/{id_memo:[0-9]+}", Delete[*Memo]).Methods("DELETE")
+	subrouter.HandleFunc("/memo/{id_memo:[0-9]+}/label/", ReplaceLinks[Label, *Memo]).Methods("PUT")
+	subrouter.HandleFunc("/memo/{id_memo:[0-9]+}/label/{id_label:[0-9]+}", Link[Label, *Memo]).Methods("PUT")
+	subrouter.HandleFunc("/memo_item/", Create[*MemoItem]).Methods("POST")
+	subrouter.HandleFunc("/session/", func(w http.ResponseWriter, r *http.Request) {
+		session, _ := SessionFrom(r.Context())
+		json.NewEncoder(w).Encode(session)
+	}).Methods("GET")
 	router.ServeHTTP(rec, req)
 
 	return rec
@@ -210,3 +577,86 @@ func (a MockAuth) Create(user string) string {
 func (a MockAuth) Use(token string) bool {
 	return token == "123-token"
 }
+
+type MockIdentifier struct {
+	MockAuth
+}
+
+func (a MockIdentifier) Use(token string) bool {
+	return token == "123-token" || token == "admin-token"
+}
+
+func (a MockIdentifier) Identify(token string) (*data.Identity, bool) {
+
+	switch token {
+	case "123-token":
+		return &data.Identity{UserID: "a", Roles: []string{"reader"}, Tenant: "t", Claims: map[string]any{"sub": "a"}}, true
+	case "admin-token":
+		return &data.Identity{UserID: "b", Roles: []string{"admin"}, Tenant: "t", Claims: map[string]any{"sub": "b"}}, true
+	}
+
+	return nil, false
+}
+
+type MockRefresher struct {
+	MockAuth
+	revoked []string
+}
+
+func (a *MockRefresher) isRevoked(token string) bool {
+
+	for _, item := range a.revoked {
+		if item == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *MockRefresher) Use(token string) bool {
+	return token == "a-access" && !a.isRevoked(token)
+}
+
+func (a *MockRefresher) CreatePair(user string) (data.TokenPair, error) {
+	return data.TokenPair{AccessToken: user + "-access", RefreshToken: user + "-refresh", ExpiresIn: 900}, nil
+}
+
+func (a *MockRefresher) Refresh(refreshToken string) (data.TokenPair, error) {
+
+	if refreshToken != "a-refresh" || a.isRevoked(refreshToken) {
+		return data.TokenPair{}, errors.New("invalid token")
+	}
+
+	return a.CreatePair("a")
+}
+
+func (a *MockRefresher) Revoke(token string) error {
+
+	if token != "a-access" && token != "a-refresh" {
+		return errors.New("invalid token")
+	}
+
+	a.revoked = append(a.revoked, token)
+
+	return nil
+}
+
+func (a *MockRefresher) RevokePair(accessToken string, refreshToken string) error {
+
+	if !a.Use(accessToken) {
+		return errors.New("invalid token")
+	}
+
+	if refreshToken != "" && (refreshToken != "a-refresh" || a.isRevoked(refreshToken)) {
+		return errors.New("invalid token")
+	}
+
+	a.revoked = append(a.revoked, accessToken)
+
+	if refreshToken != "" {
+		a.revoked = append(a.revoked, refreshToken)
+	}
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// The modes of the nested parameter on updates, merging the given children
+// into the current ones or replacing them, deleting those left out.
+const (
+	nestedMerge   = "merge"
+	nestedReplace = "replace"
+)
+
+// validationFailed wraps the error of a validator of a nested child, told
+// apart from those of the database.
+type validationFailed struct {
+	err error
+}
+
+func (e validationFailed) Error() string {
+	return e.err.Error()
+}
+
+func (e validationFailed) Unwrap() error {
+	return e.err
+}
+
+var errNotSaved = errors.New("not saved")
+
+// nestedRelations returns the has one and has many relations of s tagged
+// as `crud:"nested"`, whose children are written along with their parent.
+func nestedRelations(s *schema.Schema) []*schema.Relationship {
+
+	var relations []*schema.Relationship
+
+	for _, rel := range append(append([]*schema.Relationship{}, s.Relationships.HasOne...), s.Relationships.HasMany...) {
+		if tagHas(rel.Field.Tag, "nested") {
+			relations = append(relations, rel)
+		}
+	}
+
+	return relations
+}
+
+// primaryKey returns the primary key of value, a row of s, as a string, or
+// an empty one when it is not set.
+func primaryKey(ctx context.Context, s *schema.Schema, value reflect.Value) string {
+
+	var key string
+
+	for _, field := range s.PrimaryFields {
+
+		part, zero := field.ValueOf(ctx, value)
+		if zero {
+			return ""
+		}
+
+		key += fmt.Sprint(part) + ","
+	}
+
+	return key
+}
+
+// validateChild calls the ValidateCreate or, when old is valid, the
+// ValidateUpdate method of child, a pointer, when it has one.
+func validateChild(ctx context.Context, child reflect.Value, old reflect.Value) error {
+
+	var err error
+
+	if !old.IsValid() {
+		if validator, ok := child.Interface().(interface {
+			ValidateCreate(ctx context.Context) error
+		}); ok {
+			err = validator.ValidateCreate(ctx)
+		}
+	} else if method := child.MethodByName("ValidateUpdate"); method.IsValid() && method.Type().NumIn() == 2 {
+
+		if method.Type().In(1) != old.Type() {
+			old = old.Elem()
+		}
+
+		if method.Type().In(1) == old.Type() {
+			if result := method.Call([]reflect.Value{reflect.ValueOf(ctx), old})[0]; !result.IsNil() {
+				err = result.Interface().(error)
+			}
+		}
+	}
+
+	if err != nil {
+		return validationFailed{err}
+	}
+
+	return nil
+}
+
+// writeNested validates and saves the children given in raw, the JSON of
+// value, a row of s, for its nested relations, recursively. Children with
+// the primary key of a current one update it, the others are created and,
+// on replace, the current ones left out are deleted.
+func writeNested(ctx context.Context, tx *gorm.DB, s *schema.Schema, value reflect.Value, raw []byte, mode string) error {
+
+	var fields map[string]json.RawMessage
+
+	err := json.Unmarshal(raw, &fields)
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range nestedRelations(s) {
+
+		items, ok := fields[jsonName(rel.Field)]
+		if !ok || string(items) == "null" {
+			continue
+		}
+
+		var list []json.RawMessage
+
+		if rel.Type == schema.HasOne {
+			list = append(list, items)
+		} else {
+			err = json.Unmarshal(items, &list)
+			if err != nil {
+				return err
+			}
+		}
+
+		rows := reflect.New(reflect.SliceOf(rel.FieldSchema.ModelType))
+
+		err = dependentsQuery(ctx, tx, rel, value).Find(rows.Interface()).Error
+		if err != nil {
+			return err
+		}
+
+		current := map[string]reflect.Value{}
+		for i := 0; i < rows.Elem().Len(); i++ {
+			current[primaryKey(ctx, rel.FieldSchema, rows.Elem().Index(i))] = rows.Elem().Index(i)
+		}
+
+		kept := map[string]bool{}
+
+		for _, item := range list {
+
+			child := reflect.New(rel.FieldSchema.ModelType)
+
+			err = json.Unmarshal(item, child.Interface())
+			if err != nil {
+				return err
+			}
+
+			var old reflect.Value
+
+			key := primaryKey(ctx, rel.FieldSchema, child.Elem())
+
+			// a has one child is the current one unless told otherwise
+			if rel.Type == schema.HasOne && key == "" && len(current) == 1 {
+				for key = range current {
+				}
+			}
+
+			if row, ok := current[key]; ok && key != "" {
+
+				old = reflect.New(rel.FieldSchema.ModelType)
+				old.Elem().Set(row)
+
+				// the given fields are merged into the current child
+				child.Elem().Set(row)
+				err = json.Unmarshal(item, child.Interface())
+				if err != nil {
+					return err
+				}
+
+				kept[key] = true
+			}
+
+			for _, ref := range rel.References {
+				if ref.OwnPrimaryKey {
+					parent, _ := ref.PrimaryKey.ValueOf(ctx, value)
+					err = ref.ForeignKey.Set(ctx, child.Elem(), parent)
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			// children are owned as their parents are
+			if old.IsValid() {
+				err = checkOwner(ctx, child.Interface(), old.Interface())
+				if err != nil {
+					return validationFailed{err}
+				}
+			} else {
+				err = setOwner(ctx, child.Interface())
+				if err != nil {
+					return err
+				}
+			}
+
+			err = validateChild(ctx, child, old)
+			if err != nil {
+				return err
+			}
+
+			var previous any
+			if old.IsValid() {
+				previous = old.Interface()
+			}
+
+			var invalid data.ValidationError
+
+			err = checkRefs(ctx, tx, child.Interface(), previous)
+			if errors.As(err, &invalid) {
+				return validationFailed{err}
+			}
+			if err != nil {
+				return err
+			}
+
+			if old.IsValid() {
+				err = tx.Omit(clause.Associations).Save(child.Interface()).Error
+			} else {
+				err = tx.Omit(clause.Associations).Create(child.Interface()).Error
+			}
+			if err != nil {
+				return err
+			}
+
+			err = writeNested(ctx, tx, rel.FieldSchema, child.Elem(), item, mode)
+			if err != nil {
+				return err
+			}
+		}
+
+		if mode != nestedReplace {
+			continue
+		}
+
+		for key, row := range current {
+
+			if kept[key] {
+				continue
+			}
+
+			child := reflect.New(rel.FieldSchema.ModelType)
+			child.Elem().Set(row)
+
+			if validator, ok := child.Interface().(data.DeleteValidator); ok {
+				err = validator.ValidateDelete(ctx)
+				if err != nil {
+					return validationFailed{err}
+				}
+			}
+
+			dependents, err := deleteDependents(ctx, tx, rel.FieldSchema, child.Elem())
+			if err != nil {
+				return err
+			}
+
+			if len(dependents) > 0 {
+				return errRestricted
+			}
+
+			err = tx.Delete(child.Interface()).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeNestedError writes the status of err, returned by a write of nested
+// children.
+func writeNestedError(w http.ResponseWriter, err error) {
+
+	var failed validationFailed
+
+	switch {
+	case errors.As(err, &failed):
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%v", failed.err)
+	case errors.Is(err, errRestricted):
+		w.WriteHeader(http.StatusConflict)
+	case errors.Is(err, errNoOwner):
+		writeProblem(w, http.StatusForbidden, "an identity is required to own the item")
+	default:
+		w.WriteHeader(http.StatusNotAcceptable)
+	}
+}
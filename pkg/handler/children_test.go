@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeChildren(t *testing.T, method string, url string, body string) int {
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	rec := serveHTTP(req)
+
+	return rec.Code
+}
+
+func TestCreateChildren(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	code := writeChildren(t, "POST", "/dummy/", "{\"title\":\"title\",\"valid\":true,\"children\":[{\"title\":\"child1\",\"valid\":true,\"children\":[{\"title\":\"grandchild\"}]},{\"title\":\"child2\",\"valid\":true}]}")
+
+	assert.Equal(t, http.StatusCreated, code)
+
+	var children []SubDummy
+	db.Where(SubDummy{Dummy: 1}).Find(&children)
+
+	assert.Equal(t, 2, len(children))
+	assert.Equal(t, "child1", children[0].Title)
+	assert.Equal(t, "child2", children[1].Title)
+
+	var grandchildren []SubSubDummy
+	db.Find(&grandchildren)
+
+	assert.Equal(t, 1, len(grandchildren))
+	assert.Equal(t, children[0].ID, grandchildren[0].SubDummy)
+}
+
+func TestCreateChildrenInvalid(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	req, err := http.NewRequest("POST", "/dummy/", strings.NewReader("{\"title\":\"title\",\"valid\":true,\"children\":[{\"title\":\"child1\",\"valid\":true},{\"title\":\"child2\"}]}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "{\"code\":1,\"message\":\"Error - Not Valid\"}", rec.Body.String())
+
+	var count int64
+	db.Model(&Dummy{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	db.Model(&SubDummy{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestUpdateChildrenMerge(t *testing.T) {
+
+	setupDb(1)
+	defer destroyDb()
+
+	code := writeChildren(t, "PATCH", "/dummy/1", "{\"valid\":true,\"children\":[{\"id_subdummy\":1,\"title\":\"title_new\"},{\"title\":\"child3\",\"valid\":true}]}")
+
+	assert.Equal(t, http.StatusOK, code)
+
+	var children []SubDummy
+	db.Where(SubDummy{Dummy: 1}).Find(&children)
+
+	assert.Equal(t, 3, len(children))
+	assert.Equal(t, "title_new", children[0].Title)
+	assert.Equal(t, true, children[0].Valid)
+	assert.Equal(t, "subtitle1", children[1].Title)
+	assert.Equal(t, "child3", children[2].Title)
+}
+
+func TestUpdateChildrenReplace(t *testing.T) {
+
+	setupDb(1)
+	defer destroyDb()
+
+	db.Create(&SubSubDummy{ID: 1, Title: "subsubtitle1", SubDummy: 1})
+
+	code := writeChildren(t, "PATCH", "/dummy/1?nested=replace", "{\"valid\":true,\"children\":[{\"id_subdummy\":2}]}")
+
+	assert.Equal(t, http.StatusConflict, code)
+
+	code = writeChildren(t, "PATCH", "/dummy/1?nested=replace", "{\"valid\":true,\"children\":[{\"id_subdummy\":1,\"children\":[]}]}")
+
+	assert.Equal(t, http.StatusOK, code)
+
+	var children []SubDummy
+	db.Where(SubDummy{Dummy: 1}).Find(&children)
+
+	assert.Equal(t, 1, len(children))
+	assert.Equal(t, 1, children[0].ID)
+
+	var count int64
+	db.Model(&SubSubDummy{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestUpdateChildrenInvalid(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	code := writeChildren(t, "PATCH", "/dummy/1?nested=wrong", "{\"valid\":true}")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code = writeChildren(t, "PATCH", "/dummy/1", "{\"title\":\"title_new\",\"valid\":true,\"children\":[{\"id_subdummy\":1,\"valid\":false}]}")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	// the children of another parent are not taken over
+	code = writeChildren(t, "PATCH", "/dummy/1", "{\"title\":\"title_new\",\"valid\":true,\"children\":[{\"id_subdummy\":3,\"title\":\"title_new\",\"valid\":true}]}")
+	assert.Equal(t, http.StatusNotAcceptable, code)
+
+	var obj Dummy
+	db.First(&obj, 1)
+	assert.Equal(t, "title2", obj.Title)
+
+	var child SubDummy
+	db.First(&child, 1)
+	assert.Equal(t, true, child.Valid)
+
+	var other SubDummy
+	db.First(&other, 3)
+	assert.Equal(t, "subtitle1", other.Title)
+	assert.Equal(t, 2, other.Dummy)
+}
@@ -1,26 +1,84 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/diogomattioli/crud/pkg/data"
 	"github.com/gorilla/mux"
 	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
 )
 
+// Session is what is known of the requester, stored in the request context
+// under Session{} as a key.
 type Session struct {
-	Token string
+	Token    string
+	Identity *data.Identity
 }
 
 var db *gorm.DB
 
+// sessionContext returns the context of r holding its session, the one
+// stored by Auth or else one with the token found by the token extractors.
+func sessionContext(r *http.Request) context.Context {
+
+	if _, ok := SessionFrom(r.Context()); ok {
+		return r.Context()
+	}
+
+	return context.WithValue(r.Context(), Session{}, Session{Token: requestToken(r)})
+}
+
+// SessionFrom returns the session stored in ctx.
+func SessionFrom(ctx context.Context) (Session, bool) {
+	session, ok := ctx.Value(Session{}).(Session)
+	return session, ok
+}
+
 func SetDatabase(_db *gorm.DB) {
 	db = _db
 }
 
-func getObject[T any](vars []byte) (T, error) {
+func parseSchema(obj any) (*schema.Schema, error) {
+
+	stmt := &gorm.Statement{DB: db}
+
+	err := stmt.Parse(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	return stmt.Schema, nil
+}
+
+func jsonName(field *schema.Field) string {
+
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+// lookupField finds the field of s by its Go or JSON name, never those
+// hidden from JSON, which must not be reachable through the parameters.
+func lookupField(s *schema.Schema, name string) *schema.Field {
+
+	for _, field := range s.Fields {
+		if field.DBName != "" && jsonName(field) != "-" && (field.Name == name || jsonName(field) == name) {
+			return field
+		}
+	}
+
+	return nil
+}
+
+func getObject[T any](tx *gorm.DB, vars []byte) (T, error) {
 
 	var obj T
 
@@ -31,7 +89,7 @@ func getObject[T any](vars []byte) (T, error) {
 		return obj, errors.New("unmarshal failed")
 	}
 
-	res := db.Where(where).Or("1 != 1").First(&obj)
+	res := tx.Where(where).Or("1 != 1").First(&obj)
 	if res.RowsAffected == 0 {
 		return obj, errors.New("object not found")
 	}
@@ -53,3 +111,75 @@ func varsToJson(r *http.Request) ([]byte, error) {
 
 	return bytes, nil
 }
+
+// pickKeys keeps only the given JSON keys of raw, an object or an array of
+// them. A dotted key keeps a key of a nested value and "*" every key of its
+// level.
+func pickKeys(raw json.RawMessage, keys []string) (json.RawMessage, error) {
+
+	if len(keys) == 0 {
+		return raw, nil
+	}
+
+	var slice []json.RawMessage
+	if json.Unmarshal(raw, &slice) == nil {
+		for i := range slice {
+			picked, err := pickKeys(slice[i], keys)
+			if err != nil {
+				return nil, err
+			}
+			slice[i] = picked
+		}
+		return json.Marshal(slice)
+	}
+
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil || obj == nil {
+		return raw, nil
+	}
+
+	picked := map[string]json.RawMessage{}
+	nested := map[string][]string{}
+
+	for _, key := range keys {
+
+		if key == "*" {
+			for name, value := range obj {
+				if _, ok := picked[name]; !ok {
+					picked[name] = value
+				}
+			}
+			continue
+		}
+
+		if name, rest, ok := strings.Cut(key, "."); ok {
+			nested[name] = append(nested[name], rest)
+		} else if value, ok := obj[key]; ok {
+			picked[key] = value
+		}
+	}
+
+	for name, rest := range nested {
+		if value, ok := obj[name]; ok {
+			value, err := pickKeys(value, rest)
+			if err != nil {
+				return nil, err
+			}
+			picked[name] = value
+		}
+	}
+
+	return json.Marshal(picked)
+}
+
+// marshalFields marshals v, an object or a slice of them, keeping only the
+// given JSON keys, or all of them when there are none.
+func marshalFields(v any, keys []string) ([]byte, error) {
+
+	bytes, err := json.Marshal(v)
+	if err != nil || len(keys) == 0 {
+		return bytes, err
+	}
+
+	return pickKeys(bytes, keys)
+}
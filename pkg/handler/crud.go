@@ -1,16 +1,24 @@
 package handler
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"reflect"
 
 	"github.com/diogomattioli/crud/pkg/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func Create[T data.CreateValidator](w http.ResponseWriter, r *http.Request) {
 
+	if !authorize[T](w, r, OpCreate) {
+		return
+	}
+
 	if r.Header.Get("Content-Type") != "application/json" {
 		w.WriteHeader(http.StatusUnsupportedMediaType)
 		return
@@ -29,8 +37,14 @@ func Create[T data.CreateValidator](w http.ResponseWriter, r *http.Request) {
 
 	var obj T
 
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
 	// unmarshall the object from body
-	err = json.NewDecoder(r.Body).Decode(&obj)
+	err = json.Unmarshal(body, &obj)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
@@ -43,7 +57,17 @@ func Create[T data.CreateValidator](w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.WithValue(r.Context(), Session{}, Session{Token: r.Header.Get("X-Access-Token")})
+	ctx := sessionContext(r)
+
+	err = setOwner(ctx, &obj)
+	if errors.Is(err, errNoOwner) {
+		writeProblem(w, http.StatusForbidden, "an identity is required to own the item")
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 
 	err = obj.ValidateCreate(ctx)
 	if err != nil {
@@ -52,9 +76,30 @@ func Create[T data.CreateValidator](w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := db.Create(&obj)
-	if res.RowsAffected == 0 {
-		w.WriteHeader(http.StatusNotAcceptable)
+	err = checkRefs(ctx, db, &obj, nil)
+	if err != nil {
+		writeRefsError(w, err)
+		return
+	}
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the nested children are created along with the object
+	err = db.Transaction(func(tx *gorm.DB) error {
+
+		res := tx.Omit(clause.Associations).Create(&obj)
+		if res.RowsAffected == 0 {
+			return errNotSaved
+		}
+
+		return writeNested(ctx, tx, s, reflect.Indirect(reflect.ValueOf(obj)), body, nestedMerge)
+	})
+	if err != nil {
+		writeNestedError(w, err)
 		return
 	}
 
@@ -66,19 +111,41 @@ func Create[T data.CreateValidator](w http.ResponseWriter, r *http.Request) {
 
 func Retrieve[T any](w http.ResponseWriter, r *http.Request) {
 
+	if !authorize[T](w, r, OpRetrieve) {
+		return
+	}
+
 	vars, err := varsToJson(r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	obj, err := getObject[T](vars)
+	var obj T
+
+	expansions, err := parseExpand(&obj, r.URL.Query()["expand"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !authorizeExpansions(w, r, expansions) {
+		return
+	}
+
+	tx, keys, err := selectReturnedFields(db, &obj, queryList(append(r.URL.Query()["fields"], r.URL.Query()["field"]...)), expansions)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	obj, err = getObject[T](preloadExpansions(r, ownerScope[T](r)(tx), expansions, ""), vars)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	bytes, err := json.Marshal(obj)
+	bytes, err := marshalFields(obj, keys)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -91,6 +158,10 @@ func Retrieve[T any](w http.ResponseWriter, r *http.Request) {
 
 func Update[T data.UpdateValidator[T]](w http.ResponseWriter, r *http.Request) {
 
+	if !authorize[T](w, r, OpUpdate) {
+		return
+	}
+
 	if r.Header.Get("Content-Type") != "application/json" {
 		w.WriteHeader(http.StatusUnsupportedMediaType)
 		return
@@ -107,16 +178,39 @@ func Update[T data.UpdateValidator[T]](w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	old, err := getObject[T](vars)
+	mode := r.URL.Query().Get("nested")
+	if mode == "" {
+		mode = nestedMerge
+	}
+
+	if mode != nestedMerge && mode != nestedReplace {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	scope := ownerScope[T](r)
+
+	old, err := getObject[T](scope(db), vars)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	var obj T = old
+	// loaded again, so decoding the body leaves old as it was
+	obj, err := getObject[T](scope(db), vars)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
 
 	// unmarshall the object from body
-	err = json.NewDecoder(r.Body).Decode(&obj)
+	err = json.Unmarshal(body, &obj)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
@@ -129,7 +223,14 @@ func Update[T data.UpdateValidator[T]](w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.WithValue(r.Context(), Session{}, Session{Token: r.Header.Get("X-Access-Token")})
+	ctx := sessionContext(r)
+
+	err = checkOwner(ctx, &obj, &old)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
 
 	err = obj.ValidateUpdate(ctx, old)
 	if err != nil {
@@ -138,28 +239,53 @@ func Update[T data.UpdateValidator[T]](w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := db.Save(&obj)
-	if res.RowsAffected == 0 {
-		w.WriteHeader(http.StatusNotAcceptable)
+	err = checkRefs(ctx, db, &obj, &old)
+	if err != nil {
+		writeRefsError(w, err)
+		return
+	}
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the nested children are merged or replaced along with the object
+	err = db.Transaction(func(tx *gorm.DB) error {
+
+		res := tx.Omit(clause.Associations).Save(&obj)
+		if res.RowsAffected == 0 {
+			return errNotSaved
+		}
+
+		return writeNested(ctx, tx, s, reflect.Indirect(reflect.ValueOf(obj)), body, mode)
+	})
+	if err != nil {
+		writeNestedError(w, err)
 		return
 	}
 }
 
 func Delete[T data.DeleteValidator](w http.ResponseWriter, r *http.Request) {
 
+	if !authorize[T](w, r, OpDelete) {
+		return
+	}
+
 	vars, err := varsToJson(r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	obj, err := getObject[T](vars)
+	obj, err := getObject[T](ownerScope[T](r)(db), vars)
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	ctx := context.WithValue(r.Context(), Session{}, Session{Token: r.Header.Get("X-Access-Token")})
+	ctx := sessionContext(r)
 
 	err = obj.ValidateDelete(ctx)
 	if err != nil {
@@ -168,8 +294,42 @@ func Delete[T data.DeleteValidator](w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res := db.Delete(obj)
-	if res.RowsAffected == 0 {
+	s, err := parseSchema(obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	var dependents []Dependent
+
+	// the delete policies of the relations run along with the delete
+	err = db.Transaction(func(tx *gorm.DB) error {
+
+		dependents, err = deleteDependents(ctx, tx, s, reflect.Indirect(reflect.ValueOf(obj)))
+		if err != nil {
+			return err
+		}
+
+		if len(dependents) > 0 {
+			return errRestricted
+		}
+
+		res := tx.Delete(obj)
+		if res.RowsAffected == 0 {
+			return errors.New("not deleted")
+		}
+
+		return nil
+	})
+
+	if len(dependents) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(dependents)
+		return
+	}
+
+	if err != nil {
 		w.WriteHeader(http.StatusNotAcceptable)
 		return
 	}
@@ -262,6 +262,31 @@ func TestRetrieveOk(t *testing.T) {
 	assert.Equal(t, "title4", obj.Title)
 }
 
+func TestRetrieveFields(t *testing.T) {
+
+	setupDb(10)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/7?fields=valid", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"id_dummy":7,"valid":true}`, rec.Body.String())
+
+	req, err = http.NewRequest("GET", "/dummy/7?fields=wrong", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
 func TestRetrieveOkDefaultValidate(t *testing.T) {
 
 	setupDb(10)
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const maxExpandDepth = 3
+
+// expansion is a relation to be preloaded with the fields selected on it,
+// none for all, and the relations expanded below it.
+type expansion struct {
+	relation *schema.Relationship
+	fields   []*schema.Field
+	children []*expansion
+}
+
+// splitExpand splits the comma separated values of the expand parameter,
+// ignoring the commas between the parentheses of a field list.
+func splitExpand(values []string) []string {
+
+	var list []string
+
+	for _, value := range values {
+
+		depth, start := 0, 0
+
+		for i := 0; i <= len(value); i++ {
+
+			if i < len(value) {
+				switch value[i] {
+				case '(':
+					depth++
+					continue
+				case ')':
+					depth--
+					continue
+				case ',':
+					if depth > 0 {
+						continue
+					}
+				default:
+					continue
+				}
+			}
+
+			if item := strings.TrimSpace(value[start:i]); item != "" {
+				list = append(list, item)
+			}
+			start = i + 1
+		}
+	}
+
+	return list
+}
+
+// lookupRelation finds the relation of s by its Go or JSON name, provided
+// its field is tagged as expandable.
+func lookupRelation(s *schema.Schema, name string) *schema.Relationship {
+
+	for _, rel := range s.Relationships.Relations {
+		if rel.Field != nil && (rel.Field.Name == name || jsonName(rel.Field) == name) && tagHas(rel.Field.Tag, "expand") {
+			return rel
+		}
+	}
+
+	return nil
+}
+
+// parseExpand reads the expand parameter, a comma separated list of dotted
+// relation paths each optionally followed by its fields between parentheses,
+// e.g. `children(title),children.parent`.
+func parseExpand(obj any, queries []string) ([]*expansion, error) {
+
+	items := splitExpand(queries)
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	s, err := parseSchema(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	var expansions []*expansion
+
+	for _, item := range items {
+
+		path, fields, hasFields := strings.Cut(item, "(")
+		if hasFields && !strings.HasSuffix(fields, ")") {
+			return nil, errors.New("invalid expand")
+		}
+
+		names := strings.Split(path, ".")
+		if len(names) > maxExpandDepth {
+			return nil, errors.New("expand too deep")
+		}
+
+		current, level := s, &expansions
+
+		var node *expansion
+
+		for _, name := range names {
+
+			rel := lookupRelation(current, strings.TrimSpace(name))
+			if rel == nil {
+				return nil, errors.New("inexistent expand relation")
+			}
+
+			node = nil
+			for _, exp := range *level {
+				if exp.relation == rel {
+					node = exp
+				}
+			}
+
+			if node == nil {
+				node = &expansion{relation: rel}
+				*level = append(*level, node)
+			}
+
+			current, level = rel.FieldSchema, &node.children
+		}
+
+		if hasFields {
+			for _, name := range queryList([]string{strings.TrimSuffix(fields, ")")}) {
+
+				field := lookupField(current, name)
+				if field == nil {
+					return nil, errors.New("inexistent expand field")
+				}
+
+				node.fields = append(node.fields, field)
+			}
+		}
+	}
+
+	return expansions, nil
+}
+
+// relationColumns returns the columns of s, one of the sides of rel, needed
+// to match the rows of rel.
+func relationColumns(s *schema.Schema, rel *schema.Relationship) []string {
+
+	var columns []string
+
+	for _, ref := range rel.References {
+		if ref.PrimaryKey != nil && ref.PrimaryKey.Schema == s {
+			columns = append(columns, ref.PrimaryKey.DBName)
+		}
+		if ref.ForeignKey != nil && ref.ForeignKey.Schema == s {
+			columns = append(columns, ref.ForeignKey.DBName)
+		}
+	}
+
+	return columns
+}
+
+// expandColumns returns the columns of s, holding the expansions, needed to
+// preload them.
+func expandColumns(s *schema.Schema, expansions []*expansion) []string {
+
+	var columns []string
+
+	for _, exp := range expansions {
+		columns = append(columns, relationColumns(s, exp.relation)...)
+	}
+
+	return columns
+}
+
+// expandKeys returns the JSON keys to be kept for the expansions, "*" keeping
+// every key of a level and dotted keys those of a nested one.
+func expandKeys(expansions []*expansion) []string {
+
+	var keys []string
+
+	for _, exp := range expansions {
+
+		name := jsonName(exp.relation.Field)
+
+		var nested []string
+
+		if len(exp.fields) > 0 {
+			for _, field := range exp.relation.FieldSchema.PrimaryFields {
+				nested = append(nested, jsonName(field))
+			}
+			for _, field := range exp.fields {
+				nested = append(nested, jsonName(field))
+			}
+		}
+
+		children := expandKeys(exp.children)
+		if len(children) > 0 && len(nested) == 0 {
+			nested = append(nested, "*")
+		}
+		nested = append(nested, children...)
+
+		if len(nested) == 0 {
+			keys = append(keys, name)
+		}
+
+		for _, key := range nested {
+			keys = append(keys, name+"."+key)
+		}
+	}
+
+	return keys
+}
+
+// authorizeExpansions tells whether the session of r may list the rows of
+// every expanded relation, writing a problem when it may not.
+func authorizeExpansions(w http.ResponseWriter, r *http.Request, expansions []*expansion) bool {
+
+	for _, exp := range expansions {
+		if !authorizeResource(w, r, exp.relation.FieldSchema.Table, OpList) || !authorizeExpansions(w, r, exp.children) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// preloadExpansions preloads the expanded relations on db, selecting only
+// the requested fields of those restricted, and only the rows owned by the
+// session of r of those with an owner field.
+func preloadExpansions(r *http.Request, db *gorm.DB, expansions []*expansion, prefix string) *gorm.DB {
+
+	for _, exp := range expansions {
+
+		name := prefix + exp.relation.Name
+
+		s := exp.relation.FieldSchema
+
+		scope := ownerScopeOf(r.Context(), s)
+
+		var columns []string
+
+		if len(exp.fields) > 0 {
+			for _, field := range s.PrimaryFields {
+				columns = append(columns, field.DBName)
+			}
+			for _, field := range exp.fields {
+				columns = append(columns, field.DBName)
+			}
+			columns = append(columns, relationColumns(s, exp.relation)...)
+			columns = append(columns, expandColumns(s, exp.children)...)
+		}
+
+		db = db.Preload(name, func(db *gorm.DB) *gorm.DB {
+
+			db = scope(db)
+
+			if len(columns) > 0 {
+				db = db.Select(unique(columns))
+			}
+
+			return db
+		})
+
+		db = preloadExpansions(r, db, exp.children, name+".")
+	}
+
+	return db
+}
+
+func unique(list []string) []string {
+
+	seen := map[string]bool{}
+
+	var result []string
+
+	for _, item := range list {
+		if !seen[item] {
+			seen[item] = true
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
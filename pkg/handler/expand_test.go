@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func expandRequest(t *testing.T, url string, v any) int {
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	if rec.Code == http.StatusOK {
+		err = json.NewDecoder(rec.Body).Decode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rec.Code
+}
+
+func TestRetrieveExpand(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	var obj Dummy
+
+	code := expandRequest(t, "/dummy/2?expand=children", &obj)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "title1", obj.Title)
+	assert.Equal(t, 2, len(obj.Children))
+	assert.Equal(t, 3, obj.Children[0].ID)
+	assert.Equal(t, "subtitle1", obj.Children[0].Title)
+	assert.Equal(t, true, obj.Children[0].Valid)
+}
+
+func TestRetrieveExpandFields(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	var obj map[string]any
+
+	code := expandRequest(t, "/dummy/2?fields=title&expand=children(title)", &obj)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]any{
+		"id_dummy": float64(2),
+		"title":    "title1",
+		"children": []any{
+			map[string]any{"id_subdummy": float64(3), "title": "subtitle1"},
+			map[string]any{"id_subdummy": float64(4), "title": "subtitle1"},
+		},
+	}, obj)
+}
+
+func TestListExpandNested(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	var slice []map[string]any
+
+	code := expandRequest(t, "/dummy/?fields=title&expand=children.parent(title)", &slice)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(slice))
+
+	children := slice[0]["children"].([]any)
+	assert.Equal(t, 2, len(children))
+
+	child := children[1].(map[string]any)
+	assert.Equal(t, "subtitle2", child["title"])
+	assert.Equal(t, true, child["valid"])
+	assert.Equal(t, map[string]any{"id_dummy": float64(1), "title": "title2"}, child["parent"])
+}
+
+func TestListSubExpand(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	var slice []SubDummy
+
+	code := expandRequest(t, "/dummy/1/subdummy/?expand=parent", &slice)
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, len(slice))
+	assert.Equal(t, "title2", slice[0].Parent.Title)
+	assert.Nil(t, slice[0].Hidden)
+}
+
+func TestExpandBadRequest(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	var obj map[string]any
+
+	for _, url := range []string{
+		"/dummy/1?expand=wrong",
+		"/dummy/1?expand=children(wrong)",
+		"/dummy/1?expand=children(title",
+		"/dummy/1?expand=children.parent.children.parent",
+		"/dummy/1/subdummy/?expand=hidden",
+		"/dummy/?expand=children.hidden",
+	} {
+		assert.Equal(t, http.StatusBadRequest, expandRequest(t, url, &obj), url)
+	}
+
+	assert.Equal(t, http.StatusOK, expandRequest(t, "/dummy/1?expand=children.parent.children", &obj))
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const exportBatch = 500
+
+// exportFormat picks the format from the format parameter, then the Accept
+// header, defaulting to NDJSON.
+func exportFormat(r *http.Request) string {
+
+	switch r.URL.Query().Get("format") {
+	case "ndjson":
+		return "application/x-ndjson"
+	case "csv":
+		return "text/csv"
+	case "":
+	default:
+		return ""
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		return "text/csv"
+	}
+
+	return "application/x-ndjson"
+}
+
+// csvValue renders a JSON value as a CSV cell, strings unquoted, null as an
+// empty cell and objects or arrays as their JSON. Strings which spreadsheets
+// would take for formulas are prefixed with a quote.
+func csvValue(raw json.RawMessage) string {
+
+	if raw == nil || bytes.Equal(raw, []byte("null")) {
+		return ""
+	}
+
+	var str string
+	if json.Unmarshal(raw, &str) == nil {
+		if str != "" && strings.ContainsRune("=+-@\t\r", rune(str[0])) {
+			return "'" + str
+		}
+		return str
+	}
+
+	return string(raw)
+}
+
+// Export streams every row of T matching the same filter, search, sort and
+// fields parameters as List, unpaged, as NDJSON or CSV. Failing once the
+// stream started, it aborts the response, so clients cannot take it for a
+// complete one.
+func Export[T any](w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[T](w, r, OpList) {
+		return
+	}
+
+	where, err := whereVars[T](r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	format := exportFormat(r)
+	if format == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var obj T
+
+	URLQuery := r.URL.Query()
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	innerDb, keys, err := selectReturnedFields(db, &obj, queryList(append(URLQuery["fields"], URLQuery["field"]...)), nil)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	innerDb, err = filterQuery(ownerScope[T](r)(innerDb), where, URLQuery, URLQuery.Get("sort") == "")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	innerDb, err = createSortQuery(innerDb, &obj, URLQuery.Get("sort"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rows, err := innerDb.Rows()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	if len(keys) == 0 {
+		for _, field := range s.Fields {
+			if field.DBName != "" && jsonName(field) != "-" {
+				keys = append(keys, jsonName(field))
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", format)
+
+	var writer *csv.Writer
+
+	if format == "text/csv" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", s.Table+".csv"))
+
+		writer = csv.NewWriter(w)
+		writer.Write(keys)
+	}
+
+	flusher, _ := w.(http.Flusher)
+
+	for count := 1; rows.Next(); count++ {
+
+		var obj T
+
+		err = innerDb.ScanRows(rows, &obj)
+		if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+
+		bytes, err := marshalFields(obj, keys)
+		if err != nil {
+			panic(http.ErrAbortHandler)
+		}
+
+		if writer == nil {
+			w.Write(append(bytes, '\n'))
+		} else {
+			var values map[string]json.RawMessage
+			if json.Unmarshal(bytes, &values) != nil {
+				panic(http.ErrAbortHandler)
+			}
+
+			record := make([]string, len(keys))
+			for i, key := range keys {
+				record[i] = csvValue(values[key])
+			}
+
+			writer.Write(record)
+		}
+
+		if count%exportBatch == 0 {
+			if writer != nil {
+				writer.Flush()
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	if rows.Err() != nil {
+		panic(http.ErrAbortHandler)
+	}
+
+	if writer != nil {
+		writer.Flush()
+	}
+}
@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportNDJSON(t *testing.T) {
+
+	setupDb(300)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/export/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSuffix(rec.Body.String(), "\n"), "\n")
+
+	assert.Equal(t, 300, len(lines))
+	assert.Equal(t, `{"id_dummy":1,"title":"title300","valid":true}`, lines[0])
+	assert.Equal(t, `{"id_dummy":300,"title":"title1","valid":true}`, lines[299])
+}
+
+func TestExportCSV(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	req, err := http.NewRequest("GET", "/article/export/?format=csv&sort=Title&filter[draft]=false", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="articles.csv"`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "id_article,title,body,secret,draft,published_at,reviewed_at\n"+
+		"3,golang tips,nothing else,gorm,false,2024-12-31T23:59:59Z,2024-06-10T00:00:00Z\n"+
+		"1,gorm search,strategies for lists,golang,false,2024-05-01T10:00:00Z,\n", rec.Body.String())
+
+	req, err = http.NewRequest("GET", "/article/export/?fields=title,reviewed_at&search=golang", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Accept", "text/csv")
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "id_article,title,reviewed_at\n2,routing,\n3,golang tips,2024-06-10T00:00:00Z\n", rec.Body.String())
+}
+
+func TestExportSub(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/2/subdummy/export/?fields=id_dummy", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "{\"id_dummy\":2,\"id_subdummy\":3}\n{\"id_dummy\":2,\"id_subdummy\":4}\n", rec.Body.String())
+}
+
+func TestExportBadRequest(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	for _, query := range []string{"format=xml", "fields=wrong", "sort=wrong", "filter[wrong]=1"} {
+
+		req, err := http.NewRequest("GET", "/dummy/export/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestExportCSVFormula(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	for i, title := range []string{"=1+1", "+1", "-1", "@SUM(A1)", "a=1"} {
+		db.Create(&Dummy{ID: i + 1, Title: title, Valid: true})
+	}
+
+	req, err := http.NewRequest("GET", "/dummy/export/?format=csv&sort=ID", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "id_dummy,title,valid\n1,'=1+1,true\n2,'+1,true\n3,'-1,true\n4,'@SUM(A1),true\n5,a=1,true\n", rec.Body.String())
+}
+
+func TestExportAbort(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	db.Exec("UPDATE dummies SET valid = 'wrong' WHERE id = 3")
+
+	req, err := http.NewRequest("GET", "/dummy/export/?sort=ID", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() { serveHTTP(req) })
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+
+	"gorm.io/gorm/clause"
+)
+
+// Facet responds with the distinct values of the field given as facet and
+// how many rows of T have each, among the rows matching the same filters
+// and search as List except the filter on the facet itself. The values are
+// sorted by count unless sort=value.
+func Facet[T any](w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[T](w, r, OpList) {
+		return
+	}
+
+	where, err := whereVars[T](r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	URLQuery := r.URL.Query()
+
+	var obj T
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	field := lookupField(s, URLQuery.Get("facet"))
+	if field == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	offset, limit, err := pagingParams(URLQuery)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+	count := clause.Column{Name: "count"}
+
+	var orders []clause.OrderByColumn
+
+	switch URLQuery.Get("sort") {
+	case "", "count":
+		orders = []clause.OrderByColumn{{Column: count, Desc: true, Reorder: true}, {Column: column}}
+	case "value":
+		orders = []clause.OrderByColumn{{Column: column, Reorder: true}}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// validate every filter, including the one left out below
+	_, err = createFilterQuery(db, &obj, URLQuery)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// the facet's own filter would leave a single value to choose from
+	for key := range URLQuery {
+		if match := matchFilter.FindStringSubmatch(key); match != nil && lookupField(s, match[1]) == field {
+			URLQuery.Del(key)
+		}
+	}
+
+	innerDb, err := filterQuery(ownerScope[T](r)(db), where, URLQuery, false)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	rows := []map[string]any{}
+
+	res := innerDb.Select("? AS ?, COUNT(*) AS ?", column, clause.Column{Name: "value"}, count).
+		Clauses(clause.GroupBy{Columns: []clause.Column{column}}, clause.OrderBy{Columns: orders}).
+		Offset(offset).Limit(limit).Find(&rows)
+	if res.Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	for _, row := range rows {
+		row["value"] = typedValue(r.Context(), s, field, row["value"])
+	}
+
+	w.Header().Add("X-Paging-Size", fmt.Sprint(len(rows)))
+
+	bytes, err := marshalFields(rows, nil)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	fmt.Fprintf(w, "%v", string(bytes))
+}
@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFacet(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	for query, body := range map[string]string{
+		"facet=draft":                           `[{"count":2,"value":false},{"count":1,"value":true}]`,
+		"facet=Draft&sort=value":                `[{"count":2,"value":false},{"count":1,"value":true}]`,
+		"facet=draft&limit=1":                   `[{"count":2,"value":false}]`,
+		"facet=draft&filter[draft]=true":        `[{"count":2,"value":false},{"count":1,"value":true}]`,
+		"facet=draft&filter[title]=routing":     `[{"count":1,"value":true}]`,
+		"facet=title&sort=value&search=golang":  `[{"count":1,"value":"golang tips"},{"count":1,"value":"routing"}]`,
+		"facet=title&filter[title]=wrong":       `[{"count":1,"value":"golang tips"},{"count":1,"value":"gorm search"},{"count":1,"value":"routing"}]`,
+		"facet=draft&filter[reviewed_at]=null":  `[{"count":1,"value":false},{"count":1,"value":true}]`,
+		"facet=draft&filter[id_article]=4":      `[]`,
+		"facet=draft&filter[id_article]=1,2":    `[{"count":1,"value":false},{"count":1,"value":true}]`,
+		"facet=draft&filter[published_at]=2024": `[{"count":2,"value":false},{"count":1,"value":true}]`,
+	} {
+
+		req, err := http.NewRequest("GET", "/article/facet/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, query)
+		assert.Equal(t, body, rec.Body.String(), query)
+	}
+}
+
+func TestFacetSub(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/3/subdummy/facet/?facet=title", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"count":2,"value":"subtitle3"}]`, rec.Body.String())
+}
+
+func TestFacetBadRequest(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	for _, query := range []string{"", "facet=wrong", "facet=draft&sort=wrong", "facet=draft&filter[wrong]=1", "facet=draft&filter[draft]=maybe"} {
+
+		req, err := http.NewRequest("GET", "/article/facet/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
@@ -0,0 +1,316 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const maxImportLine = 1 << 20
+
+type ImportError struct {
+	Line  int `json:"line"`
+	Error any `json:"error"`
+}
+
+type ImportReport struct {
+	Created int           `json:"created"`
+	DryRun  bool          `json:"dry_run"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// csvCell converts a CSV cell into the JSON value for field, leaving it to
+// the unmarshalling of the object to reject a value of the wrong type.
+func csvCell(field *schema.Field, cell string) any {
+
+	if cell == "" && (isNullable(field) || !isText(field)) {
+		return nil
+	}
+
+	if !isText(field) && json.Valid([]byte(cell)) {
+		return json.RawMessage(cell)
+	}
+
+	return cell
+}
+
+// readCSV converts the records of a CSV file, whose header names the
+// fields of s by their JSON or Go names, into JSON objects.
+func readCSV(s *schema.Schema, body io.Reader, each func(line int, bytes []byte, err error)) error {
+
+	reader := csv.NewReader(body)
+
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+
+	fields := make([]*schema.Field, len(header))
+	for i, name := range header {
+		if fields[i] = lookupField(s, strings.TrimSpace(name)); fields[i] == nil {
+			return fmt.Errorf("inexistent field %s", name)
+		}
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) && errors.Is(err, csv.ErrFieldCount) {
+			each(parseError.Line, nil, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		obj := map[string]any{}
+		for i, cell := range record {
+			obj[jsonName(fields[i])] = csvCell(fields[i], cell)
+		}
+
+		bytes, err := json.Marshal(obj)
+		each(line, bytes, err)
+	}
+}
+
+// readNDJSON passes on every non blank line of an NDJSON file.
+func readNDJSON(body io.Reader, each func(line int, bytes []byte, err error)) error {
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+
+	for line := 1; scanner.Scan(); line++ {
+		if bytes := bytes.TrimSpace(scanner.Bytes()); len(bytes) > 0 {
+			each(line, bytes, nil)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// importBody returns the file to import and its media type, either the
+// request body or the file part of a multipart form.
+func importBody(r *http.Request) (io.Reader, string, error) {
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "multipart/form-data" {
+		return r.Body, mediaType, nil
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return nil, "", err
+	}
+
+	mediaType, _, _ = mime.ParseMediaType(header.Header.Get("Content-Type"))
+
+	switch strings.ToLower(filepath.Ext(header.Filename)) {
+	case ".csv":
+		mediaType = "text/csv"
+	case ".ndjson", ".jsonl":
+		mediaType = "application/x-ndjson"
+	}
+
+	return file, mediaType, nil
+}
+
+// importObject creates one imported object the same way as Create, with
+// its own savepoint so a failure leaves the other objects alone.
+func importObject[T data.CreateValidator](ctx context.Context, tx *gorm.DB, bytes []byte, vars []byte) error {
+
+	var obj T
+
+	err := json.Unmarshal(bytes, &obj)
+	if err != nil {
+		return err
+	}
+
+	// overwrite id with provided in the vars/url
+	err = json.Unmarshal(vars, &obj)
+	if err != nil {
+		return err
+	}
+
+	err = setOwner(ctx, &obj)
+	if err != nil {
+		return err
+	}
+
+	err = obj.ValidateCreate(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = checkRefs(ctx, tx, &obj, nil)
+	if err != nil {
+		return err
+	}
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		return err
+	}
+
+	return tx.Transaction(func(tx *gorm.DB) error {
+
+		res := tx.Omit(clause.Associations).Create(&obj)
+		if res.Error != nil {
+			return res.Error
+		}
+
+		if res.RowsAffected == 0 {
+			return errors.New("not created")
+		}
+
+		// the nested children are validated and created as in Create
+		return writeNested(ctx, tx, s, reflect.Indirect(reflect.ValueOf(obj)), bytes, nestedMerge)
+	})
+}
+
+// Import creates an object of T for every record of a CSV or NDJSON file,
+// validated as in Create, and responds with a report of the failed lines.
+// By default nothing is created when any line fails, mode=best_effort
+// creates the valid ones and dry_run=true only validates.
+func Import[T data.CreateValidator](w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[T](w, r, OpCreate) {
+		return
+	}
+
+	if r.Body == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	vars, err := varsToJson(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	URLQuery := r.URL.Query()
+
+	dryRun := false
+	if URLQuery.Get("dry_run") != "" {
+		dryRun, err = strconv.ParseBool(URLQuery.Get("dry_run"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	bestEffort := false
+	switch URLQuery.Get("mode") {
+	case "", "atomic":
+	case "best_effort":
+		bestEffort = true
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	body, mediaType, err := importBody(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if mediaType != "text/csv" && mediaType != "application/x-ndjson" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var obj T
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx := sessionContext(r)
+
+	report := ImportReport{DryRun: dryRun, Errors: []ImportError{}}
+
+	tx := db.Begin()
+
+	each := func(line int, bytes []byte, err error) {
+
+		if err == nil {
+			err = importObject[T](ctx, tx, bytes, vars)
+		}
+
+		if err == nil {
+			report.Created++
+			return
+		}
+
+		var validationError data.ValidationError
+		if errors.As(err, &validationError) {
+			report.Errors = append(report.Errors, ImportError{Line: line, Error: validationError})
+		} else {
+			report.Errors = append(report.Errors, ImportError{Line: line, Error: err.Error()})
+		}
+	}
+
+	if mediaType == "text/csv" {
+		err = readCSV(s, body, each)
+	} else {
+		err = readNDJSON(body, each)
+	}
+
+	if err != nil {
+		tx.Rollback()
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	failed := len(report.Errors) > 0 && !bestEffort
+
+	if dryRun || failed {
+		tx.Rollback()
+	} else if tx.Commit().Error != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if failed {
+		report.Created = 0
+	}
+
+	bytes, err := json.Marshal(report)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if failed {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+
+	fmt.Fprintf(w, "%v", string(bytes))
+}
@@ -0,0 +1,189 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func importRequest(t *testing.T, url string, contentType string, body string) (int, ImportReport) {
+
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	rec := serveHTTP(req)
+
+	var report ImportReport
+	if rec.Header().Get("Content-Type") == "application/json" {
+		err = json.NewDecoder(rec.Body).Decode(&report)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rec.Code, report
+}
+
+func countDummies() int64 {
+	var total int64
+	db.Model(&Dummy{}).Count(&total)
+	return total
+}
+
+func TestImportCSV(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	code, report := importRequest(t, "/dummy/import/", "text/csv", "title,valid\na,true\n\"b, c\",true\n")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 0, len(report.Errors))
+
+	var obj Dummy
+	db.Last(&obj)
+
+	assert.Equal(t, int64(2), countDummies())
+	assert.Equal(t, "b, c", obj.Title)
+}
+
+func TestImportAtomic(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	code, report := importRequest(t, "/dummy/import/", "text/csv", "title,valid\na,true\nb,false\nc,maybe\nd,true\n")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, 0, report.Created)
+	assert.Equal(t, 2, len(report.Errors))
+	assert.Equal(t, 3, report.Errors[0].Line)
+	assert.Equal(t, map[string]any{"code": float64(1), "message": "Error - Not Valid"}, report.Errors[0].Error)
+	assert.Equal(t, 4, report.Errors[1].Line)
+	assert.Equal(t, int64(0), countDummies())
+}
+
+func TestImportBestEffort(t *testing.T) {
+
+	setupDb(1)
+	defer destroyDb()
+
+	// the second line collides with the existing primary key
+	code, report := importRequest(t, "/dummy/import/?mode=best_effort", "application/x-ndjson", "{\"title\":\"a\",\"valid\":true}\n{\"id_dummy\":1,\"title\":\"b\",\"valid\":true}\n\n{\"title\":\n{\"title\":\"d\",\"valid\":true}\n")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 2, len(report.Errors))
+	assert.Equal(t, 2, report.Errors[0].Line)
+	assert.Equal(t, 4, report.Errors[1].Line)
+	assert.Equal(t, int64(3), countDummies())
+}
+
+func TestImportDryRun(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	code, report := importRequest(t, "/dummy/import/?dry_run=true", "text/csv", "title,valid\na,true\nb,true\n")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, true, report.DryRun)
+	assert.Equal(t, int64(0), countDummies())
+}
+
+func TestImportMultipart(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	body := &bytes.Buffer{}
+
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile("file", "dummies.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	part.Write([]byte("Title,Valid\na,true\n"))
+	writer.Close()
+
+	code, report := importRequest(t, "/dummy/import/", writer.FormDataContentType(), body.String())
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, int64(1), countDummies())
+}
+
+func TestImportSub(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	code, report := importRequest(t, "/dummy/2/subdummy/import/", "text/csv", "title,valid,id_dummy\nx,true,1\n")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, report.Created)
+
+	var slice []SubDummy
+	db.Where(SubDummy{Dummy: 2}).Find(&slice)
+
+	assert.Equal(t, 3, len(slice))
+	assert.Equal(t, "x", slice[2].Title)
+
+	code, _ = importRequest(t, "/dummy/3/subdummy/import/", "text/csv", "title,valid\nx,true\n")
+
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestImportNested(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	code, report := importRequest(t, "/dummy/import/", "application/x-ndjson", "{\"title\":\"a\",\"valid\":true,\"children\":[{\"title\":\"x\",\"valid\":true}]}\n{\"title\":\"b\",\"valid\":true,\"children\":[{\"title\":\"y\",\"valid\":false}]}\n")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, 1, len(report.Errors))
+	assert.Equal(t, 2, report.Errors[0].Line)
+	assert.Equal(t, map[string]any{"code": float64(1), "message": "Error - Not Valid"}, report.Errors[0].Error)
+	assert.Equal(t, int64(0), countDummies())
+
+	code, report = importRequest(t, "/dummy/import/", "application/x-ndjson", "{\"title\":\"a\",\"valid\":true,\"children\":[{\"title\":\"x\",\"valid\":true}]}\n")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, report.Created)
+
+	var slice []SubDummy
+	db.Find(&slice)
+
+	assert.Equal(t, 1, len(slice))
+	assert.Equal(t, "x", slice[0].Title)
+	assert.Equal(t, 1, slice[0].Dummy)
+}
+
+func TestImportBadRequest(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	code, _ := importRequest(t, "/dummy/import/", "text/csv", "title,wrong\na,true\n")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = importRequest(t, "/dummy/import/?mode=wrong", "text/csv", "title,valid\na,true\n")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = importRequest(t, "/dummy/import/", "application/json", "[]")
+	assert.Equal(t, http.StatusUnsupportedMediaType, code)
+}
@@ -0,0 +1,341 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// linkRelation finds the many to many relation of S to T.
+func linkRelation[T any, S any]() (*schema.Relationship, error) {
+
+	var obj T
+	var owner S
+
+	s, err := parseSchema(&owner)
+	if err != nil {
+		return nil, err
+	}
+
+	linked, err := parseSchema(&obj)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range s.Relationships.Many2Many {
+		if rel.FieldSchema == linked {
+			return rel, nil
+		}
+	}
+
+	return nil, errors.New("inexistent many2many relation")
+}
+
+// linkedScope narrows a query on the items of rel to those linked to owner
+// through its join table.
+func linkedScope(ctx context.Context, rel *schema.Relationship, owner any) func(*gorm.DB) *gorm.DB {
+
+	value := reflect.Indirect(reflect.ValueOf(owner))
+
+	join := db.Table(rel.JoinTable.Table)
+
+	var columns []clause.Column
+	var selects []string
+
+	for _, ref := range rel.References {
+		if ref.OwnPrimaryKey {
+			key, _ := ref.PrimaryKey.ValueOf(ctx, value)
+			join = join.Where(clause.Eq{Column: clause.Column{Name: ref.ForeignKey.DBName}, Value: key})
+		} else {
+			columns = append(columns, clause.Column{Table: clause.CurrentTable, Name: ref.PrimaryKey.DBName})
+			selects = append(selects, ref.ForeignKey.DBName)
+		}
+	}
+
+	join = join.Select(selects)
+
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("? IN (?)", columns, join)
+	}
+}
+
+// ListLinked lists the items of T linked to S, found by the route vars,
+// with the same paging, filter, search, sort and fields parameters as List.
+func ListLinked[T any, S any](w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[S](w, r, OpRetrieve) {
+		return
+	}
+
+	vars, err := varsToJson(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rel, err := linkRelation[T, S]()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	owner, err := getObject[S](ownerScope[S](r)(db), vars)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	list[T](w, r, linkedScope(r.Context(), rel, owner))
+}
+
+// Link links the item of T to S, both found by the route vars. Linking an
+// item already linked succeeds without changes.
+func Link[T any, S data.LinkValidator[T]](w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[S](w, r, OpUpdate) {
+		return
+	}
+
+	vars, err := varsToJson(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rel, err := linkRelation[T, S]()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	owner, err := getObject[S](ownerScope[S](r)(db), vars)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	obj, err := getObject[T](ownerScope[T](r)(db), vars)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = owner.ValidateLink(sessionContext(r), obj)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	err = db.Model(owner).Association(rel.Name).Append(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unlink unlinks the item of T from S, both found by the route vars.
+func Unlink[T any, S data.LinkValidator[T]](w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[S](w, r, OpUpdate) {
+		return
+	}
+
+	vars, err := varsToJson(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rel, err := linkRelation[T, S]()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	owner, err := getObject[S](ownerScope[S](r)(db), vars)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	obj, err := getObject[T](linkedScope(r.Context(), rel, owner)(ownerScope[T](r)(db)), vars)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = owner.ValidateUnlink(sessionContext(r), obj)
+	if err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	err = db.Model(owner).Association(rel.Name).Delete(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReplaceLinks replaces the items of T linked to S, found by the route vars,
+// with those whose primary keys are given as a JSON array in the body,
+// validating each item linked or unlinked. Linked items the caller cannot
+// see are kept linked.
+func ReplaceLinks[T any, S data.LinkValidator[T]](w http.ResponseWriter, r *http.Request) {
+
+	if !authorize[S](w, r, OpUpdate) {
+		return
+	}
+
+	if r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if r.Body == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	vars, err := varsToJson(r)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	rel, err := linkRelation[T, S]()
+	if err != nil || len(rel.FieldSchema.PrimaryFields) != 1 {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	owner, err := getObject[S](ownerScope[S](r)(db), vars)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var ids []json.RawMessage
+
+	err = json.NewDecoder(r.Body).Decode(&ids)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	primary := rel.FieldSchema.PrimaryFields[0]
+
+	keyOf := func(obj T) string {
+		key, _ := primary.ValueOf(r.Context(), reflect.Indirect(reflect.ValueOf(obj)))
+		return fmt.Sprint(key)
+	}
+
+	objs := []T{}
+	linking := map[string]T{}
+
+	for _, id := range ids {
+
+		// ids of another type than the primary key are malformed
+		key := reflect.New(primary.FieldType)
+
+		err = json.Unmarshal(id, key.Interface())
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		lookup, err := json.Marshal(map[string]any{jsonName(primary): key.Elem().Interface()})
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		obj, err := getObject[T](ownerScope[T](r)(db), lookup)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if _, ok := linking[keyOf(obj)]; !ok {
+			linking[keyOf(obj)] = obj
+			objs = append(objs, obj)
+		}
+	}
+
+	all := []T{}
+
+	err = db.Model(owner).Association(rel.Name).Find(&all)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// only the linked items visible to the caller are replaced, the others
+	// are kept linked as they are
+	current := []T{}
+
+	err = linkedScope(r.Context(), rel, owner)(ownerScope[T](r)(db)).Find(&current).Error
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	ctx := sessionContext(r)
+
+	linked := map[string]bool{}
+
+	for _, obj := range current {
+
+		linked[keyOf(obj)] = true
+
+		if _, ok := linking[keyOf(obj)]; !ok {
+			err = owner.ValidateUnlink(ctx, obj)
+			if err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprintf(w, "%v", err)
+				return
+			}
+		}
+	}
+
+	for _, obj := range objs {
+		if !linked[keyOf(obj)] {
+			err = owner.ValidateLink(ctx, obj)
+			if err != nil {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				fmt.Fprintf(w, "%v", err)
+				return
+			}
+		}
+	}
+
+	for _, obj := range all {
+		if _, ok := linking[keyOf(obj)]; !ok && !linked[keyOf(obj)] {
+			objs = append(objs, obj)
+		}
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Model(owner).Association(rel.Name).Replace(&objs)
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTags() {
+
+	db.Create(&Tag{ID: 1, Name: "go"})
+	db.Create(&Tag{ID: 2, Name: "gorm"})
+	db.Create(&Tag{ID: 3, Name: "locked"})
+	db.Create(&Tag{ID: 4, Name: "pinned"})
+
+	db.Model(&Dummy{ID: 1}).Association("Tags").Append(&Tag{ID: 2, Name: "gorm"}, &Tag{ID: 4, Name: "pinned"})
+}
+
+func linkedTags(t *testing.T, url string) (int, []Tag) {
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	var slice []Tag
+	json.NewDecoder(rec.Body).Decode(&slice)
+
+	return rec.Code, slice
+}
+
+func TestListLinked(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupTags()
+
+	code, slice := linkedTags(t, "/dummy/1/tag/")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []Tag{{ID: 2, Name: "gorm"}, {ID: 4, Name: "pinned"}}, slice)
+
+	code, slice = linkedTags(t, "/dummy/1/tag/?search=pin")
+
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []Tag{{ID: 4, Name: "pinned"}}, slice)
+
+	code, _ = linkedTags(t, "/dummy/2/tag/")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = linkedTags(t, "/dummy/3/tag/")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestLink(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupTags()
+
+	for _, url := range []string{"/dummy/2/tag/1", "/dummy/2/tag/1", "/dummy/1/tag/1"} {
+
+		req, err := http.NewRequest("PUT", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+	}
+
+	_, slice := linkedTags(t, "/dummy/2/tag/")
+	assert.Equal(t, []Tag{{ID: 1, Name: "go"}}, slice)
+
+	_, slice = linkedTags(t, "/dummy/1/tag/")
+	assert.Equal(t, 3, len(slice))
+
+	req, err := http.NewRequest("PUT", "/dummy/2/tag/3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "{\"code\":1,\"message\":\"Error - Locked\"}", rec.Body.String())
+
+	req, err = http.NewRequest("PUT", "/dummy/2/tag/5", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestUnlink(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupTags()
+
+	for url, code := range map[string]int{
+		"/dummy/1/tag/1": http.StatusNotFound,
+		"/dummy/2/tag/2": http.StatusNotFound,
+		"/dummy/1/tag/4": http.StatusUnprocessableEntity,
+		"/dummy/1/tag/2": http.StatusNoContent,
+	} {
+
+		req, err := http.NewRequest("DELETE", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, code, rec.Code, url)
+	}
+
+	_, slice := linkedTags(t, "/dummy/1/tag/")
+	assert.Equal(t, []Tag{{ID: 4, Name: "pinned"}}, slice)
+
+	var tag Tag
+	db.First(&tag, 2)
+
+	assert.Equal(t, "gorm", tag.Name)
+}
+
+func TestReplaceLinks(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupTags()
+
+	for _, test := range []struct {
+		body string
+		code int
+	}{
+		{"[1,2]", http.StatusUnprocessableEntity},
+		{"[1,3,4]", http.StatusUnprocessableEntity},
+		{"[1,9]", http.StatusNotFound},
+		{"{}", http.StatusBadRequest},
+		{"[\"1\"]", http.StatusBadRequest},
+		{"[{\"id_tag\":1}]", http.StatusBadRequest},
+		{"[1.5]", http.StatusBadRequest},
+		{"[1,4,1]", http.StatusNoContent},
+	} {
+
+		req, err := http.NewRequest("PUT", "/dummy/1/tag/", strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		rec := serveHTTP(req)
+
+		assert.Equal(t, test.code, rec.Code, test.body)
+	}
+
+	_, slice := linkedTags(t, "/dummy/1/tag/")
+	assert.Equal(t, []Tag{{ID: 1, Name: "go"}, {ID: 4, Name: "pinned"}}, slice)
+
+	req, err := http.NewRequest("PUT", "/dummy/2/tag/", strings.NewReader("[]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -1,16 +1,21 @@
 package handler
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/diogomattioli/crud/pkg/data"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 const (
@@ -18,27 +23,91 @@ const (
 	defaultLimit = 50
 )
 
-func createSearchQuery[T any](db *gorm.DB, obj T, queries []string) *gorm.DB {
+// queryList splits the comma separated values of a repeatable parameter.
+func queryList(values []string) []string {
 
-	ty := reflect.TypeOf(obj).Elem()
+	var list []string
+
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+
+	return list
+}
+
+// createSearchQuery narrows db to the rows matching any of the queries,
+// text fields through the search strategy and the others by their type,
+// optionally restricted to the named fields. Results are ordered by
+// relevance when ranked and the strategy supports it.
+func createSearchQuery[T any](db *gorm.DB, obj T, queries []string, names []string, ranked bool) (*gorm.DB, error) {
+
+	if len(queries) == 0 {
+		return db, nil
+	}
+
+	s, err := parseSchema(obj)
+	if err != nil {
+		return db, err
+	}
+
+	target := searchTarget(s)
+	fields := searchableFields(s)
+
+	if len(names) > 0 {
+
+		searchable := map[*schema.Field]bool{}
+		for _, field := range fields {
+			searchable[field] = true
+		}
+
+		fields = nil
+
+		for _, name := range names {
+			field := lookupField(s, name)
+			if field == nil || !searchable[field] {
+				return db, errors.New("inexistent search field")
+			}
+			fields = append(fields, field)
+			target.Only = append(target.Only, field.DBName)
+		}
+	}
+
+	searchesText := len(target.Searched()) > 0
+
+	var exprs []clause.Expression
+	var texts []string
 
 	for _, query := range queries {
-		for j := 0; j < ty.NumField(); j++ {
 
-			typeName := ty.Field(j).Type.Name()
-			fieldName := ty.Field(j).Name
+		if data.Valid(query) && searchesText {
+			exprs = append(exprs, searchStrategy.Match(db, target, query))
+			texts = append(texts, query)
+		}
 
-			if data.Valid(query) && (typeName == "string" || typeName == "NullString") {
-				db = db.Or(fmt.Sprintf("%s LIKE LOWER(?)", data.ToSnakeCase(fieldName)), "%"+query+"%")
-			} else if value, err := strconv.Atoi(query); err == nil && (strings.HasPrefix(typeName, "int") || strings.HasPrefix(typeName, "NullInt")) {
-				db = db.Or(fmt.Sprintf("%s = ?", data.ToSnakeCase(fieldName)), value)
-			} else if value, err := strconv.ParseFloat(query, 64); err == nil && (strings.HasPrefix(typeName, "float") || strings.HasPrefix(typeName, "NullFloat")) {
-				db = db.Or(fmt.Sprintf("%s = ?", data.ToSnakeCase(fieldName)), value)
+		for _, field := range fields {
+			if expr := typedMatch(field, query); expr != nil {
+				exprs = append(exprs, expr)
 			}
 		}
 	}
 
-	return db
+	if len(exprs) == 0 {
+		return db, nil
+	}
+
+	db = db.Where(anyOf(exprs))
+
+	if ranked && len(texts) > 0 {
+		if rank := searchStrategy.Rank(db, target, texts); rank != nil {
+			db = db.Clauses(clause.OrderBy{Expression: rank})
+		}
+	}
+
+	return db, nil
 }
 
 func createSortQuery[T any](db *gorm.DB, obj T, query string) (*gorm.DB, error) {
@@ -57,41 +126,277 @@ func createSortQuery[T any](db *gorm.DB, obj T, query string) (*gorm.DB, error)
 	return db, nil
 }
 
-func selectReturnedFields[T any](db *gorm.DB, obj T, queries []string) (*gorm.DB, error) {
-	var fields []string
+// selectReturnedFields restricts the selected columns to the fields named
+// by their JSON or Go names, always adding the primary key and the columns
+// the expansions depend on, and returns the JSON keys to be kept in the
+// response.
+func selectReturnedFields[T any](db *gorm.DB, obj T, queries []string, expansions []*expansion) (*gorm.DB, []string, error) {
+
+	if len(queries) == 0 {
+		if len(expansions) == 0 {
+			return db, nil, nil
+		}
+		return db, append([]string{"*"}, expandKeys(expansions)...), nil
+	}
+
+	s, err := parseSchema(obj)
+	if err != nil {
+		return db, nil, err
+	}
+
+	var columns, keys []string
+
+	for _, field := range s.PrimaryFields {
+		columns = append(columns, field.DBName)
+		keys = append(keys, jsonName(field))
+	}
 
-	ty := reflect.TypeOf(obj).Elem()
 	for _, query := range queries {
-		for i := 0; i < ty.NumField(); i++ {
-			if ty.Field(i).Name == query {
-				fields = append(fields, ty.Field(i).Name)
-				break
-			}
+
+		field := lookupField(s, query)
+		if field == nil {
+			return db, nil, errors.New("inexistent field")
+		}
+
+		if !field.PrimaryKey {
+			columns = append(columns, field.DBName)
+			keys = append(keys, jsonName(field))
+		}
+	}
+
+	columns = append(columns, expandColumns(s, expansions)...)
+	keys = append(keys, expandKeys(expansions)...)
+
+	return db.Select(unique(columns)), keys, nil
+}
+
+func listOptions[T any]() data.ListOptions {
+
+	var obj T
+
+	options := data.ListOptions{}
+
+	if listable, ok := any(obj).(data.Listable); ok {
+		options = listable.ListOptions()
+	} else if listable, ok := any(&obj).(data.Listable); ok {
+		options = listable.ListOptions()
+	}
+
+	if options.Count == "" {
+		options.Count = data.CountExact
+	}
+
+	return options
+}
+
+// countTotal counts the rows matched by tx according to mode, returning the
+// mode actually used since estimates fall back to counting when unavailable.
+func countTotal(tx *gorm.DB, mode data.CountMode, limit int64) (int64, data.CountMode) {
+
+	var total int64
+
+	// estimates come from table statistics, so they only hold without conditions
+	if _, filtered := tx.Statement.Clauses["WHERE"]; mode == data.CountEstimated && !filtered {
+		if total, ok := estimateTotal(tx); ok {
+			return total, data.CountEstimated
+		}
+	}
+
+	if limit > 0 {
+		// one more row than the limit tells whether there are more
+		capped := tx.Select("1").Limit(int(limit) + 1)
+		tx.Session(&gorm.Session{NewDB: true}).Table("(?) AS capped", capped).Count(&total)
+		if total > limit {
+			return limit, data.CountCapped
+		}
+		return total, data.CountExact
+	}
+
+	tx.Count(&total)
+
+	return total, data.CountExact
+}
+
+func estimateTotal(tx *gorm.DB) (int64, bool) {
+
+	err := tx.Statement.Parse(tx.Statement.Model)
+	if err != nil {
+		return 0, false
+	}
+
+	var total sql.NullInt64
+
+	switch tx.Dialector.Name() {
+	case "postgres":
+		tx = tx.Session(&gorm.Session{NewDB: true}).Raw("SELECT reltuples::bigint FROM pg_class WHERE oid = to_regclass(?)", tx.Statement.Table).Scan(&total)
+	case "mysql":
+		tx = tx.Session(&gorm.Session{NewDB: true}).Raw("SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?", tx.Statement.Table).Scan(&total)
+	default:
+		return 0, false
+	}
+
+	// postgres reports -1 for tables that were never analyzed
+	if tx.Error != nil || !total.Valid || total.Int64 < 0 {
+		return 0, false
+	}
+
+	return total.Int64, true
+}
+
+// pagingParams reads the offset and limit parameters of query.
+func pagingParams(query url.Values) (int, int, error) {
+
+	var err error
+
+	offset := 0
+	if query.Get("offset") != "" {
+		offset, err = strconv.Atoi(query.Get("offset"))
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	limit := defaultLimit
+	if query.Get("limit") != "" {
+		limit, err = strconv.Atoi(query.Get("limit"))
+		if err != nil {
+			return 0, 0, err
 		}
 	}
 
-	if len(fields) < len(queries) {
-		return db, errors.New("inexistent field")
+	if offset < 0 || limit <= 0 || limit > maxLimit {
+		return 0, 0, errors.New("invalid paging")
+	}
+
+	return offset, limit, nil
+}
+
+var matchFilter = regexp.MustCompile(`^filter\[(.+)\]$`)
+
+func isNullable(field *schema.Field) bool {
+	return field.FieldType.Kind() == reflect.Pointer || strings.HasPrefix(field.FieldType.Name(), "Null")
+}
+
+// fieldFilter matches field against value, text by equality, null on
+// nullable fields by IS NULL and the others as in a typed search.
+func fieldFilter(field *schema.Field, value string) (clause.Expression, error) {
+
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+	if value == "null" && isNullable(field) {
+		return clause.Eq{Column: column, Value: nil}, nil
+	}
+
+	if isText(field) {
+		return clause.Eq{Column: column, Value: value}, nil
+	}
+
+	if expr := typedMatch(field, value); expr != nil {
+		return expr, nil
 	}
 
-	if len(fields) > 0 {
-		return db.Select(fields), nil
+	return nil, errors.New("invalid filter value")
+}
+
+// createFilterQuery narrows db by the filter[name]=value parameters, the
+// values of one field matched with OR and the fields with AND. Values are
+// given by repeating the parameter, or comma separated but for text fields,
+// whose values may hold commas.
+func createFilterQuery[T any](db *gorm.DB, obj T, query url.Values) (*gorm.DB, error) {
+
+	var s *schema.Schema
+
+	for key, values := range query {
+
+		match := matchFilter.FindStringSubmatch(key)
+		if match == nil {
+			continue
+		}
+
+		if s == nil {
+			var err error
+			if s, err = parseSchema(obj); err != nil {
+				return db, err
+			}
+		}
+
+		field := lookupField(s, match[1])
+		if field == nil {
+			return db, errors.New("inexistent filter field")
+		}
+
+		if !isText(field) {
+			values = queryList(values)
+		}
+
+		var exprs []clause.Expression
+
+		for _, value := range values {
+
+			if value == "" {
+				continue
+			}
+
+			expr, err := fieldFilter(field, value)
+			if err != nil {
+				return db, err
+			}
+
+			exprs = append(exprs, expr)
+		}
+
+		if len(exprs) > 0 {
+			db = db.Where(anyOf(exprs))
+		}
 	}
 
 	return db, nil
 }
 
-func List[T any](w http.ResponseWriter, r *http.Request) {
+// filterQuery scopes db to the rows of T matching where, taken from the
+// route vars, and the filter and search parameters of query.
+func filterQuery[T any](db *gorm.DB, where T, query url.Values, ranked bool) (*gorm.DB, error) {
 
-	vars, err := varsToJson(r)
+	var obj T
+
+	db, err := createFilterQuery(db.Model(&obj).Where(where), &obj, query)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+		return db, err
 	}
 
+	return createSearchQuery(db, &obj, query["search"], queryList(query["search_fields"]), ranked)
+}
+
+// whereVars unmarshals the route vars of r into the conditions on T.
+func whereVars[T any](r *http.Request) (T, error) {
+
 	var where T
 
+	vars, err := varsToJson(r)
+	if err != nil {
+		return where, err
+	}
+
 	err = json.Unmarshal(vars, &where)
+	if err != nil {
+		return where, errors.New("unmarshal failed")
+	}
+
+	return where, nil
+}
+
+func List[T any](w http.ResponseWriter, r *http.Request) {
+	list[T](w, r, nil)
+}
+
+// list serves the rows of T as List does, narrowed by scope when given.
+func list[T any](w http.ResponseWriter, r *http.Request, scope func(*gorm.DB) *gorm.DB) {
+
+	if !authorize[T](w, r, OpList) {
+		return
+	}
+
+	where, err := whereVars[T](r)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -100,44 +405,45 @@ func List[T any](w http.ResponseWriter, r *http.Request) {
 	w.Header().Add("X-Paging-MaxLimit", fmt.Sprint(maxLimit))
 	w.Header().Add("X-Paging-DefaultLimit", fmt.Sprint(defaultLimit))
 
-	var slice []T
 	var obj T
 
-	innerDb := db
+	options := listOptions[T]()
 
 	URLQuery := r.URL.Query()
 
-	offset := 0
-	if URLQuery.Get("offset") != "" {
-		offset, err = strconv.Atoi(URLQuery.Get("offset"))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	offset, limit, err := pagingParams(URLQuery)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	limit := defaultLimit
-	if URLQuery.Get("limit") != "" {
-		limit, err = strconv.Atoi(URLQuery.Get("limit"))
-		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			return
-		}
+	expansions, err := parseExpand(&obj, URLQuery["expand"])
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
-	if offset < 0 || limit <= 0 || limit > maxLimit {
-		w.WriteHeader(http.StatusBadRequest)
+	if !authorizeExpansions(w, r, expansions) {
 		return
 	}
 
-	innerDb, err = selectReturnedFields(innerDb, &obj, URLQuery["field"])
+	innerDb, keys, err := selectReturnedFields(db, &obj, queryList(append(URLQuery["fields"], URLQuery["field"]...)), expansions)
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
 
 	// Filters
-	innerDb = createSearchQuery(innerDb, &obj, URLQuery["search"])
+	innerDb, err = filterQuery(ownerScope[T](r)(innerDb), where, URLQuery, URLQuery.Get("sort") == "")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if scope != nil {
+		innerDb = scope(innerDb)
+	}
+
 	innerDb, err = createSortQuery(innerDb, &obj, URLQuery.Get("sort"))
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
@@ -145,24 +451,37 @@ func List[T any](w http.ResponseWriter, r *http.Request) {
 	}
 	// Filters
 
-	var total int64
-	innerDb.Model(obj).Where(where).Count(&total)
-	if total == 0 {
-		w.WriteHeader(http.StatusNotFound)
-		return
+	countMode := options.Count
+	if URLQuery.Get("count") != "" {
+		countMode = data.CountMode(URLQuery.Get("count"))
+		if !countMode.Valid() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	if countMode != data.CountNone {
+		total, mode := countTotal(innerDb.Session(&gorm.Session{}), countMode, options.CountLimit)
+		if total == 0 && mode != data.CountEstimated && !options.EmptyOK {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Add("X-Paging-Total", fmt.Sprint(total))
+		w.Header().Add("X-Paging-Count", string(mode))
 	}
 
-	w.Header().Add("X-Paging-Total", fmt.Sprint(total))
+	slice := []T{}
 
-	innerDb.Offset(offset).Limit(limit).Where(where).Find(&slice)
-	if len(slice) == 0 {
+	preloadExpansions(r, innerDb.Session(&gorm.Session{}), expansions, "").Offset(offset).Limit(limit).Find(&slice)
+	if len(slice) == 0 && !options.EmptyOK {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
 	w.Header().Add("X-Paging-Size", fmt.Sprint(len(slice)))
 
-	bytes, err := json.Marshal(slice)
+	bytes, err := marshalFields(slice, keys)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
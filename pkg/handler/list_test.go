@@ -217,11 +217,37 @@ func TestListFields(t *testing.T) {
 	}
 
 	assert.Equal(t, 1, len(slice))
-	assert.Equal(t, 0, slice[0].ID)
+	assert.Equal(t, 1, slice[0].ID)
 	assert.Equal(t, "title1", slice[0].Title)
 	assert.Equal(t, true, slice[0].Valid)
 }
 
+func TestListFieldsJsonNames(t *testing.T) {
+
+	setupDb(3)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/?fields=title&limit=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"id_dummy":1,"title":"title3"},{"id_dummy":2,"title":"title2"}]`, rec.Body.String())
+
+	req, err = http.NewRequest("GET", "/dummy/3/subdummy/?fields=title,id_dummy", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"id_dummy":3,"id_subdummy":5,"title":"subtitle1"},{"id_dummy":3,"id_subdummy":6,"title":"subtitle1"}]`, rec.Body.String())
+}
+
 func TestListFieldsWrongField(t *testing.T) {
 
 	setupDb(1)
@@ -529,3 +555,175 @@ func TestListMisconfigured(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 }
+
+func TestListEmptyOK(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy_list/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "", rec.Header().Get("X-Paging-Total"))
+	assert.Equal(t, "0", rec.Header().Get("X-Paging-Size"))
+	assert.Equal(t, "[]", rec.Body.String())
+}
+
+func TestListCountNone(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/?count=none", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "", rec.Header().Get("X-Paging-Total"))
+	assert.Equal(t, "", rec.Header().Get("X-Paging-Count"))
+	assert.Equal(t, "5", rec.Header().Get("X-Paging-Size"))
+}
+
+func TestListCountEstimated(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/?count=estimated", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	// sqlite has no estimates, so it falls back to counting
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "5", rec.Header().Get("X-Paging-Total"))
+	assert.Equal(t, "exact", rec.Header().Get("X-Paging-Count"))
+}
+
+func TestListCountCapped(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy_list/?count=exact", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("X-Paging-Total"))
+	assert.Equal(t, "capped", rec.Header().Get("X-Paging-Count"))
+	assert.Equal(t, "5", rec.Header().Get("X-Paging-Size"))
+
+	req, err = http.NewRequest("GET", "/dummy_list/?count=exact&search=title2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Paging-Total"))
+	assert.Equal(t, "exact", rec.Header().Get("X-Paging-Count"))
+
+	// as many rows as the limit are counted exactly
+	db.Delete(&DummyList{}, []int{4, 5})
+
+	req, err = http.NewRequest("GET", "/dummy_list/?count=exact", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("X-Paging-Total"))
+	assert.Equal(t, "exact", rec.Header().Get("X-Paging-Count"))
+}
+
+func TestListCountBadRequest(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/?count=abc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestListFilter(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	for query, total := range map[string]string{
+		"filter[draft]=false":                             "2",
+		"filter[title]=routing&filter[title]=golang tips": "2",
+		"filter[title]=routing&filter[title]=golang":      "1",
+		"filter[id_article]=1,2&filter[id_article]=3":     "3",
+		"filter[reviewed_at]=null":                        "2",
+		"filter[Draft]=false&filter[reviewed_at]=2024-06": "1",
+		"filter[draft]=false&search=gorm":                 "1",
+	} {
+
+		req, err := http.NewRequest("GET", "/article/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, query)
+		assert.Equal(t, total, rec.Header().Get("X-Paging-Total"), query)
+	}
+
+	// text values are not split on commas
+	db.Create(&Article{ID: 4, Title: "routing, again", Draft: true})
+
+	for query, total := range map[string]string{
+		"filter[title]=routing%2C%20again":  "1",
+		"filter[title]=routing,golang tips": "",
+	} {
+
+		req, err := http.NewRequest("GET", "/article/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, total, rec.Header().Get("X-Paging-Total"), query)
+	}
+
+	for _, query := range []string{"filter[wrong]=1", "filter[draft]=maybe", "filter[published_at]=never"} {
+
+		req, err := http.NewRequest("GET", "/article/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/diogomattioli/crud/pkg/data"
 	"github.com/gorilla/mux"
@@ -22,9 +23,12 @@ import (
 var enableDbLogging bool = false
 
 type Dummy struct {
-	ID    int    `json:"id_dummy,omitempty" gorm:"primaryKey"`
-	Title string `json:"title,omitempty"`
-	Valid bool   `json:"valid,omitempty"`
+	ID       int        `json:"id_dummy,omitempty" gorm:"primaryKey"`
+	Title    string     `json:"title,omitempty"`
+	Valid    bool       `json:"valid,omitempty"`
+	Children []SubDummy `json:"children,omitempty" gorm:"foreignKey:Dummy" crud:"expand,ondelete=cascade,nested"`
+	Tags     []Tag      `json:"tags,omitempty" gorm:"many2many:dummy_tags" crud:"expand,ondelete=cascade"`
+	Notes    []Note     `json:"notes,omitempty" gorm:"foreignKey:Dummy" crud:"ondelete=setnull"`
 }
 
 func (o *Dummy) GetID() int {
@@ -35,6 +39,9 @@ func (o *Dummy) ValidateCreate(ctx context.Context) error {
 	if !o.Valid {
 		return data.ValidationErrorNew(1, "Error - Not Valid")
 	}
+	if session, ok := SessionFrom(ctx); ok && session.Identity.HasRole("reader") {
+		return data.ValidationErrorNew(1, fmt.Sprintf("Reader - %+v", session.Identity.UserID))
+	}
 	if session, ok := ctx.Value(Session{}).(Session); ok && session.Token != "" {
 		return data.ValidationErrorNew(1, fmt.Sprintf("Token - %+v", session.Token))
 	}
@@ -62,11 +69,65 @@ func (o *Dummy) ValidateDelete(ctx context.Context) error {
 	return nil
 }
 
+func (o *Dummy) ValidateRead(ctx context.Context) error {
+	if !o.Valid {
+		return data.ValidationErrorNew(1, "Error - Not Valid")
+	}
+	return nil
+}
+
+func (o *Dummy) ValidateLink(ctx context.Context, tag Tag) error {
+	if tag.Name == "locked" {
+		return data.ValidationErrorNew(1, "Error - Locked")
+	}
+	return nil
+}
+
+func (o *Dummy) ValidateUnlink(ctx context.Context, tag Tag) error {
+	if tag.Name == "pinned" {
+		return data.ValidationErrorNew(1, "Error - Pinned")
+	}
+	return nil
+}
+
+type Tag struct {
+	ID   int    `json:"id_tag" gorm:"primaryKey"`
+	Name string `json:"name"`
+}
+
+type Note struct {
+	data.Validate[*Note] `json:"-" gorm:"-"`
+	ID                   int    `json:"id_note" gorm:"primaryKey"`
+	Text                 string `json:"text"`
+	Dummy                *int   `json:"id_dummy" crud:"ref=Dummy"`
+}
+
+func (o *Note) GetID() int {
+	return o.ID
+}
+
+// Comment holds the key of its Dummy in a plain column, without a relation
+// declared by either of them.
+type Comment struct {
+	data.Validate[*Comment] `json:"-" gorm:"-"`
+	ID                      int    `json:"id_comment" gorm:"primaryKey"`
+	Text                    string `json:"text"`
+	Dummy                   int    `json:"id_dummy"`
+}
+
+func (o *Comment) GetID() int {
+	return o.ID
+}
+
 type SubDummy struct {
-	ID    int    `json:"id_subdummy" gorm:"primaryKey"`
-	Title string `json:"title"`
-	Valid bool   `json:"valid"`
-	Dummy int    `json:"id_dummy"`
+	ID     int    `json:"id_subdummy" gorm:"primaryKey"`
+	Title  string `json:"title"`
+	Valid  bool   `json:"valid"`
+	Dummy  int    `json:"id_dummy" crud:"ref=Dummy"`
+	Parent *Dummy `json:"parent,omitempty" gorm:"foreignKey:Dummy" crud:"expand"`
+	Hidden *Dummy `json:"hidden,omitempty" gorm:"foreignKey:Dummy"`
+
+	Children []SubSubDummy `json:"children,omitempty" gorm:"foreignKey:SubDummy" crud:"ondelete=restrict,nested"`
 }
 
 func (o *SubDummy) GetID() int {
@@ -94,6 +155,18 @@ func (o *SubDummy) ValidateDelete(ctx context.Context) error {
 	return nil
 }
 
+type SubSubDummy struct {
+	data.Validate[*SubSubDummy] `json:"-" gorm:"-"`
+	ID                          int       `json:"id_subsubdummy" gorm:"primaryKey"`
+	Title                       string    `json:"title"`
+	SubDummy                    int       `json:"id_parent"`
+	Parent                      *SubDummy `json:"parent,omitempty" gorm:"foreignKey:SubDummy"`
+}
+
+func (o *SubSubDummy) GetID() int {
+	return o.ID
+}
+
 type DummyDefault struct {
 	data.Validate[*DummyDefault] `json:"-" gorm:"-"`
 	DummyDefaultID               int    `json:"id_dummy_default,omitempty" gorm:"primaryKey"`
@@ -104,6 +177,89 @@ func (o *DummyDefault) GetID() int {
 	return o.DummyDefaultID
 }
 
+type DummyList struct {
+	ID    int    `json:"id_dummy_list" gorm:"primaryKey"`
+	Title string `json:"title"`
+}
+
+func (DummyList) ListOptions() data.ListOptions {
+	return data.ListOptions{EmptyOK: true, Count: data.CountNone, CountLimit: 3}
+}
+
+type Article struct {
+	ID          int           `json:"id_article" gorm:"primaryKey"`
+	Title       string        `json:"title" crud:"weight=2"`
+	Body        string        `json:"body"`
+	Secret      string        `json:"secret" crud:"nosearch"`
+	Draft       bool          `json:"draft"`
+	PublishedAt time.Time     `json:"published_at"`
+	ReviewedAt  data.NullTime `json:"reviewed_at"`
+}
+
+func setupArticles() {
+
+	db.AutoMigrate(&Article{})
+
+	reviewed := data.NullTime{}
+	reviewed.Valid = true
+	reviewed.Time = time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+
+	db.Create(&Article{ID: 1, Title: "gorm search", Body: "strategies for lists", Secret: "golang", PublishedAt: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)})
+	db.Create(&Article{ID: 2, Title: "routing", Body: "golang handlers and gorm", Secret: "search", Draft: true, PublishedAt: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)})
+	db.Create(&Article{ID: 3, Title: "golang tips", Body: "nothing else", Secret: "gorm", PublishedAt: time.Date(2024, 12, 31, 23, 59, 59, 0, time.UTC), ReviewedAt: reviewed})
+}
+
+type Memo struct {
+	data.Validate[*Memo]     `json:"-" gorm:"-"`
+	data.LinkValidate[Label] `json:"-" gorm:"-"`
+	ID                       int        `json:"id_memo" gorm:"primaryKey"`
+	Title                    string     `json:"title"`
+	Owner                    string     `json:"owner" crud:"owner"`
+	Items                    []MemoItem `json:"items,omitempty" gorm:"foreignKey:Memo" crud:"expand,nested"`
+	Labels                   []Label    `json:"labels,omitempty" gorm:"many2many:memo_labels"`
+}
+
+func (o *Memo) GetID() int {
+	return o.ID
+}
+
+type MemoItem struct {
+	data.Validate[*MemoItem] `json:"-" gorm:"-"`
+	ID                       int    `json:"id_memo_item" gorm:"primaryKey"`
+	Memo                     int    `json:"id_memo" crud:"ref=Memo"`
+	Text                     string `json:"text"`
+	Owner                    string `json:"owner" crud:"owner"`
+}
+
+func (o *MemoItem) GetID() int {
+	return o.ID
+}
+
+type Label struct {
+	ID    int    `json:"id_label" gorm:"primaryKey"`
+	Name  string `json:"name"`
+	Owner string `json:"owner" crud:"owner"`
+}
+
+func setupMemos() {
+
+	db.AutoMigrate(&Memo{})
+	db.AutoMigrate(&MemoItem{})
+	db.AutoMigrate(&Label{})
+
+	db.Create(&Memo{ID: 1, Title: "first", Owner: "a"})
+	db.Create(&Memo{ID: 2, Title: "second", Owner: "b"})
+	db.Create(&Memo{ID: 3, Title: "third", Owner: "a"})
+
+	db.Create(&MemoItem{ID: 1, Memo: 1, Text: "mine", Owner: "a"})
+	db.Create(&MemoItem{ID: 2, Memo: 1, Text: "theirs", Owner: "b"})
+
+	db.Create(&Label{ID: 1, Name: "mine", Owner: "a"})
+	db.Create(&Label{ID: 2, Name: "theirs", Owner: "b"})
+
+	RegisterModel[Memo]()
+}
+
 func setupDb(quantity int) {
 
 	var newLogger logger.Interface
@@ -122,17 +278,25 @@ func setupDb(quantity int) {
 	}
 
 	db.AutoMigrate(&Dummy{})
+	db.AutoMigrate(&Tag{})
+	db.AutoMigrate(&Note{})
 	db.AutoMigrate(&SubDummy{})
+	db.AutoMigrate(&Comment{})
+	db.AutoMigrate(&SubSubDummy{})
 	db.AutoMigrate(&DummyDefault{})
+	db.AutoMigrate(&DummyList{})
 
 	for i := 1; i <= quantity; i++ {
 		db.Create(&Dummy{ID: i, Title: fmt.Sprintf("title%v", quantity-i+1), Valid: true})
 		db.Create(&SubDummy{ID: i*2 - 1, Title: fmt.Sprintf("subtitle%v", quantity-i+1), Valid: true, Dummy: i})
 		db.Create(&SubDummy{ID: i * 2, Title: fmt.Sprintf("subtitle%v", quantity-i+1), Valid: true, Dummy: i})
 		db.Create(&DummyDefault{DummyDefaultID: i, Title: fmt.Sprintf("title%v", quantity-i+1)})
+		db.Create(&DummyList{ID: i, Title: fmt.Sprintf("title%v", quantity-i+1)})
 	}
 
 	SetDatabase(db)
+
+	RegisterModel[Dummy]()
 }
 
 func destroyDb() {
@@ -149,17 +313,45 @@ func serveHTTP(req *http.Request) *httptest.ResponseRecorder {
 	router := mux.NewRouter().StrictSlash(true)
 
 	router.HandleFunc("/dummy/", List[Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/aggregate/", Aggregate[Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/export/", Export[Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/import/", Import[*Dummy]).Methods("POST")
 	router.HandleFunc("/dummy/", Create[*Dummy]).Methods("POST")
 	router.HandleFunc("/dummy/{id_dummy:[0-9]+}", Retrieve[Dummy]).Methods("GET")
 	router.HandleFunc("/dummy/{id_dummy:[0-9]+}", Update[*Dummy]).Methods("PATCH")
 	router.HandleFunc("/dummy/{id_dummy:[0-9]+}", Delete[*Dummy]).Methods("DELETE")
 
 	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/", ListSub[SubDummy, Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/aggregate/", AggregateSub[SubDummy, Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/facet/", FacetSub[SubDummy, Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/export/", ExportSub[SubDummy, Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/import/", ImportSub[*SubDummy, Dummy]).Methods("POST")
 	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/", CreateSub[*SubDummy, Dummy]).Methods("POST")
 	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/{id_subdummy:[0-9]+}", RetrieveSub[SubDummy, Dummy]).Methods("GET")
 	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/{id_subdummy:[0-9]+}", UpdateSub[*SubDummy, Dummy]).Methods("PATCH")
 	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/{id_subdummy:[0-9]+}", DeleteSub[*SubDummy, Dummy]).Methods("DELETE")
 
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/{id_subdummy:[0-9]+}/subsubdummy/", Nested[SubSubDummy](List[SubSubDummy], ParentOf[Dummy](), ParentOf[SubDummy]())).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/{id_subdummy:[0-9]+}/subsubdummy/", Nested[*SubSubDummy](Create[*SubSubDummy], ParentOf[Dummy](), ParentOf[SubDummy]())).Methods("POST")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/{id_subdummy:[0-9]+}/subsubdummy/{id_subsubdummy:[0-9]+}", Nested[SubSubDummy](Retrieve[SubSubDummy], ParentOf[Dummy](), ParentOf[SubDummy]())).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/{id_subdummy:[0-9]+}/subsubdummy/{id_subsubdummy:[0-9]+}", Nested[*SubSubDummy](Update[*SubSubDummy], ParentOf[Dummy](), ParentOf[SubDummy]())).Methods("PATCH")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/subdummy/{id_subdummy:[0-9]+}/subsubdummy/{id_subsubdummy:[0-9]+}", Nested[*SubSubDummy](Delete[*SubSubDummy], ParentOf[Dummy](), ParentOf[SubDummy]())).Methods("DELETE")
+
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/tag/", ListLinked[Tag, Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/tag/", ReplaceLinks[Tag, *Dummy]).Methods("PUT")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/tag/{id_tag:[0-9]+}", Link[Tag, *Dummy]).Methods("PUT")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/tag/{id_tag:[0-9]+}", Unlink[Tag, *Dummy]).Methods("DELETE")
+
+	router.HandleFunc("/note/", Create[*Note]).Methods("POST")
+	router.HandleFunc("/note/{id_note:[0-9]+}", Update[*Note]).Methods("PATCH")
+	router.HandleFunc("/subdummy/", Create[*SubDummy]).Methods("POST")
+
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/comment/", ListSub[Comment, Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/comment/", CreateSub[*Comment, Dummy]).Methods("POST")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/comment/{id_comment:[0-9]+}", RetrieveSub[Comment, Dummy]).Methods("GET")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/comment/{id_comment:[0-9]+}", UpdateSub[*Comment, Dummy]).Methods("PATCH")
+	router.HandleFunc("/dummy/{id_dummy:[0-9]+}/comment/{id_comment:[0-9]+}", DeleteSub[*Comment, Dummy]).Methods("DELETE")
+
 	router.HandleFunc("/misconfigured/{id_wrong}/subdummy/", ListSub[SubDummy, Dummy]).Methods("GET")
 	router.HandleFunc("/misconfigured/{id_wrong}/subdummy/", CreateSub[*SubDummy, Dummy]).Methods("POST")
 	router.HandleFunc("/misconfigured/{id_wrong}/subdummy/{id_wrong}", RetrieveSub[*SubDummy, Dummy]).Methods("GET")
@@ -172,6 +364,13 @@ func serveHTTP(req *http.Request) *httptest.ResponseRecorder {
 	router.HandleFunc("/dummy_default/{id_dummy_default:[0-9]+}", Update[*DummyDefault]).Methods("PATCH")
 	router.HandleFunc("/dummy_default/{id_dummy_default:[0-9]+}", Delete[*DummyDefault]).Methods("DELETE")
 
+	router.HandleFunc("/dummy_list/", List[DummyList]).Methods("GET")
+
+	router.HandleFunc("/article/", List[Article]).Methods("GET")
+	router.HandleFunc("/article/aggregate/", Aggregate[Article]).Methods("GET")
+	router.HandleFunc("/article/facet/", Facet[Article]).Methods("GET")
+	router.HandleFunc("/article/export/", Export[Article]).Methods("GET")
+
 	router.ServeHTTP(rec, req)
 
 	return rec
@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupSubSubDummies() {
+	db.Create(&SubSubDummy{ID: 1, Title: "subsubtitle1", SubDummy: 1})
+	db.Create(&SubSubDummy{ID: 2, Title: "subsubtitle2", SubDummy: 1})
+	db.Create(&SubSubDummy{ID: 3, Title: "subsubtitle3", SubDummy: 3})
+}
+
+func TestNestedList(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupSubSubDummies()
+
+	req, err := http.NewRequest("GET", "/dummy/1/subdummy/1/subsubdummy/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var slice []SubSubDummy
+	json.NewDecoder(rec.Body).Decode(&slice)
+
+	assert.Equal(t, 2, len(slice))
+	assert.Equal(t, "subsubtitle1", slice[0].Title)
+	assert.Equal(t, "subsubtitle2", slice[1].Title)
+}
+
+func TestNestedWrongParent(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupSubSubDummies()
+
+	for _, url := range []string{
+		"/dummy/1/subdummy/3/subsubdummy/",
+		"/dummy/3/subdummy/1/subsubdummy/",
+		"/dummy/2/subdummy/3/subsubdummy/1",
+		"/dummy/1/subdummy/2/subsubdummy/1",
+	} {
+
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code, url)
+	}
+}
+
+func TestNestedUnrelated(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupSubSubDummies()
+
+	for _, handler := range []func(http.ResponseWriter, *http.Request){
+		Nested[SubSubDummy](List[SubSubDummy], ParentOf[Dummy]()),
+		Nested[SubSubDummy](List[SubSubDummy], ParentOf[SubDummy](), ParentOf[Dummy]()),
+	} {
+
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req = mux.SetURLVars(req, map[string]string{"id_dummy": "1", "id_subdummy": "1"})
+
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	}
+}
+
+func TestSubWithoutRelation(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	db.Create(&Comment{ID: 1, Text: "comment1", Dummy: 1})
+	db.Create(&Comment{ID: 2, Text: "comment2", Dummy: 2})
+
+	req, err := http.NewRequest("GET", "/dummy/1/comment/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var slice []Comment
+	json.NewDecoder(rec.Body).Decode(&slice)
+
+	assert.Equal(t, 1, len(slice))
+	assert.Equal(t, "comment1", slice[0].Text)
+
+	req, err = http.NewRequest("POST", "/dummy/2/comment/", strings.NewReader(`{"text":"comment3","id_dummy":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var obj Comment
+	db.Last(&obj)
+
+	assert.Equal(t, "comment3", obj.Text)
+	assert.Equal(t, 2, obj.Dummy)
+
+	for _, test := range []struct {
+		method string
+		url    string
+		code   int
+	}{
+		{"GET", "/dummy/1/comment/1", http.StatusOK},
+		{"GET", "/dummy/2/comment/1", http.StatusNotFound},
+		{"GET", "/dummy/3/comment/", http.StatusNotFound},
+		{"PATCH", "/dummy/1/comment/1", http.StatusOK},
+		{"PATCH", "/dummy/1/comment/2", http.StatusNotFound},
+		{"DELETE", "/dummy/2/comment/1", http.StatusNotFound},
+		{"DELETE", "/dummy/2/comment/2", http.StatusNoContent},
+	} {
+
+		req, err := http.NewRequest(test.method, test.url, strings.NewReader(`{"text":"changed"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, test.code, rec.Code, test.method+" "+test.url)
+	}
+}
+
+func TestNestedRetrieve(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupSubSubDummies()
+
+	req, err := http.NewRequest("GET", "/dummy/2/subdummy/3/subsubdummy/3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var obj SubSubDummy
+	json.NewDecoder(rec.Body).Decode(&obj)
+
+	assert.Equal(t, "subsubtitle3", obj.Title)
+	assert.Equal(t, 3, obj.SubDummy)
+}
+
+func TestNestedCreate(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	req, err := http.NewRequest("POST", "/dummy/2/subdummy/4/subsubdummy/", strings.NewReader("{\"title\":\"title\",\"id_parent\":1}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var obj SubSubDummy
+	db.First(&obj)
+
+	assert.Equal(t, 4, obj.SubDummy)
+	assert.Equal(t, "title", obj.Title)
+}
+
+func TestNestedUpdateDelete(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupSubSubDummies()
+
+	req, err := http.NewRequest("PATCH", "/dummy/1/subdummy/2/subsubdummy/1", strings.NewReader("{\"title\":\"title_new\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req, err = http.NewRequest("PATCH", "/dummy/1/subdummy/1/subsubdummy/1", strings.NewReader("{\"title\":\"title_new\",\"id_parent\":3}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var obj SubSubDummy
+	db.First(&obj, 1)
+
+	assert.Equal(t, "title_new", obj.Title)
+	assert.Equal(t, 1, obj.SubDummy)
+
+	req, err = http.NewRequest("DELETE", "/dummy/2/subdummy/3/subsubdummy/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req, err = http.NewRequest("DELETE", "/dummy/1/subdummy/1/subsubdummy/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// The delete policies set on a relation by `crud:"ondelete=policy"`. The
+// rows depending on a deleted one through it keep it from being deleted,
+// are deleted along with it or have their foreign keys set to null. Many
+// to many relations only ever delete their links.
+const (
+	deleteRestrict = "restrict"
+	deleteCascade  = "cascade"
+	deleteSetNull  = "setnull"
+)
+
+// Dependent is a relation whose rows keep a row from being deleted.
+type Dependent struct {
+	Relation string `json:"relation"`
+	Count    int64  `json:"count"`
+}
+
+var errRestricted = errors.New("restricted by dependents")
+
+// dependentsQuery scopes tx to the rows depending on value through rel, the
+// links in its join table for many to many relations.
+func dependentsQuery(ctx context.Context, tx *gorm.DB, rel *schema.Relationship, value reflect.Value) *gorm.DB {
+
+	if rel.JoinTable != nil {
+		tx = tx.Table(rel.JoinTable.Table)
+	} else {
+		tx = tx.Model(reflect.New(rel.FieldSchema.ModelType).Interface())
+	}
+
+	for _, ref := range rel.References {
+
+		column := clause.Column{Table: clause.CurrentTable, Name: ref.ForeignKey.DBName}
+
+		if ref.OwnPrimaryKey {
+			key, _ := ref.PrimaryKey.ValueOf(ctx, value)
+			tx = tx.Where(clause.Eq{Column: column, Value: key})
+		} else if ref.PrimaryValue != "" {
+			tx = tx.Where(clause.Eq{Column: column, Value: ref.PrimaryValue})
+		}
+	}
+
+	return tx
+}
+
+// addDependent adds count rows of relation to dependents.
+func addDependent(dependents []Dependent, relation string, count int64) []Dependent {
+
+	for i := range dependents {
+		if dependents[i].Relation == relation {
+			dependents[i].Count += count
+			return dependents
+		}
+	}
+
+	return append(dependents, Dependent{Relation: relation, Count: count})
+}
+
+// deleteDependents applies the delete policies of the relations of s to the
+// rows depending on value, cascading through the deleted ones, and returns
+// the dependents restricting its deletion.
+func deleteDependents(ctx context.Context, tx *gorm.DB, s *schema.Schema, value reflect.Value) ([]Dependent, error) {
+
+	var dependents []Dependent
+
+	relations := append(append(append([]*schema.Relationship{}, s.Relationships.HasOne...), s.Relationships.HasMany...), s.Relationships.Many2Many...)
+
+	for _, rel := range relations {
+
+		policy, ok := parseTag(rel.Field.Tag)["ondelete"]
+		if !ok {
+			continue
+		}
+
+		name := jsonName(rel.Field)
+
+		switch {
+		case policy == deleteRestrict:
+
+			var count int64
+
+			err := dependentsQuery(ctx, tx, rel, value).Count(&count).Error
+			if err != nil {
+				return nil, err
+			}
+
+			if count > 0 {
+				dependents = addDependent(dependents, name, count)
+			}
+
+		case rel.JoinTable != nil && (policy == deleteCascade || policy == deleteSetNull):
+
+			err := dependentsQuery(ctx, tx, rel, value).Delete(map[string]any{}).Error
+			if err != nil {
+				return nil, err
+			}
+
+		case policy == deleteCascade:
+
+			rows := reflect.New(reflect.SliceOf(rel.FieldSchema.ModelType))
+
+			err := dependentsQuery(ctx, tx, rel, value).Find(rows.Interface()).Error
+			if err != nil {
+				return nil, err
+			}
+
+			for i := 0; i < rows.Elem().Len(); i++ {
+
+				nested, err := deleteDependents(ctx, tx, rel.FieldSchema, rows.Elem().Index(i))
+				if err != nil {
+					return nil, err
+				}
+
+				for _, dependent := range nested {
+					dependents = addDependent(dependents, name+"."+dependent.Relation, dependent.Count)
+				}
+			}
+
+			err = dependentsQuery(ctx, tx, rel, value).Delete(reflect.New(rel.FieldSchema.ModelType).Interface()).Error
+			if err != nil {
+				return nil, err
+			}
+
+		case policy == deleteSetNull:
+
+			updates := map[string]any{}
+			for _, ref := range rel.References {
+				if ref.OwnPrimaryKey {
+					updates[ref.ForeignKey.DBName] = nil
+				}
+			}
+
+			err := dependentsQuery(ctx, tx, rel, value).UpdateColumns(updates).Error
+			if err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, errors.New("invalid ondelete policy")
+		}
+	}
+
+	return dependents, nil
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupDependents() {
+
+	setupTags()
+
+	one, two := 1, 2
+
+	db.Create(&Note{ID: 1, Text: "note1", Dummy: &one})
+	db.Create(&Note{ID: 2, Text: "note2", Dummy: &two})
+}
+
+func TestDeleteCascade(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupDependents()
+
+	req, err := http.NewRequest("DELETE", "/dummy/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	var children []SubDummy
+	db.Find(&children)
+
+	assert.Equal(t, 2, len(children))
+	assert.Equal(t, 2, children[0].Dummy)
+
+	var links int64
+	db.Table("dummy_tags").Count(&links)
+
+	assert.Equal(t, int64(0), links)
+
+	var tags int64
+	db.Model(&Tag{}).Count(&tags)
+
+	assert.Equal(t, int64(4), tags)
+
+	var notes []Note
+	db.Find(&notes)
+
+	assert.Equal(t, 2, len(notes))
+	assert.Nil(t, notes[0].Dummy)
+	assert.Equal(t, 2, *notes[1].Dummy)
+}
+
+func TestDeleteRestrict(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	setupDependents()
+	setupSubSubDummies()
+
+	req, err := http.NewRequest("DELETE", "/dummy/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "[{\"relation\":\"children.children\",\"count\":2}]\n", rec.Body.String())
+
+	var children int64
+	db.Model(&SubDummy{}).Where(SubDummy{Dummy: 1}).Count(&children)
+
+	assert.Equal(t, int64(2), children)
+
+	var links int64
+	db.Table("dummy_tags").Count(&links)
+
+	assert.Equal(t, int64(2), links)
+
+	var note Note
+	db.First(&note, 1)
+
+	assert.Equal(t, 1, *note.Dummy)
+
+	req, err = http.NewRequest("DELETE", "/dummy/2/subdummy/3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "[{\"relation\":\"children\",\"count\":1}]\n", rec.Body.String())
+
+	req, err = http.NewRequest("DELETE", "/dummy/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var adminRole = "admin"
+
+var errNoOwner = errors.New("no owner")
+
+// SetAdminRole sets the role bypassing the ownership of the rows, "admin"
+// by default.
+func SetAdminRole(role string) {
+	adminRole = role
+}
+
+// IsAdmin tells whether the session of ctx has the admin role.
+func IsAdmin(ctx context.Context) bool {
+
+	session, _ := SessionFrom(ctx)
+
+	return session.Identity.HasRole(adminRole)
+}
+
+// ownerField returns the field of s tagged as `crud:"owner"`, if any.
+func ownerField(s *schema.Schema) *schema.Field {
+
+	for _, field := range s.Fields {
+		if field.DBName != "" && tagHas(field.Tag, "owner") {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// ownerValue converts the user ID of identity to the type of field.
+func ownerValue(ctx context.Context, s *schema.Schema, field *schema.Field, identity *data.Identity) (any, error) {
+
+	row := reflect.New(s.ModelType).Elem()
+
+	err := field.Set(ctx, row, identity.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := field.ValueOf(ctx, row)
+
+	return value, nil
+}
+
+// ownerScope narrows the queries on T to the rows owned by the identity of
+// the session of r, unless T has no owner field or the identity has the
+// admin role. Anonymous requesters own no rows.
+func ownerScope[T any](r *http.Request) func(*gorm.DB) *gorm.DB {
+
+	var obj T
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		return func(tx *gorm.DB) *gorm.DB {
+			tx.AddError(err)
+			return tx
+		}
+	}
+
+	return ownerScopeOf(r.Context(), s)
+}
+
+// ownerScopeOf narrows the queries on the rows of s as ownerScope does,
+// for the session of ctx.
+func ownerScopeOf(ctx context.Context, s *schema.Schema) func(*gorm.DB) *gorm.DB {
+
+	field := ownerField(s)
+
+	session, _ := SessionFrom(ctx)
+
+	if field == nil || session.Identity.HasRole(adminRole) {
+		return func(tx *gorm.DB) *gorm.DB {
+			return tx
+		}
+	}
+
+	if session.Identity == nil {
+		return func(tx *gorm.DB) *gorm.DB {
+			return tx.Where("1 != 1")
+		}
+	}
+
+	value, err := ownerValue(ctx, s, field, session.Identity)
+
+	return func(tx *gorm.DB) *gorm.DB {
+
+		if err != nil {
+			tx.AddError(err)
+			return tx
+		}
+
+		return tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value})
+	}
+}
+
+// setOwner fills the owner field of obj with the identity of the session
+// of ctx, keeping the one given by requesters with the admin role.
+func setOwner(ctx context.Context, obj any) error {
+
+	s, err := parseSchema(obj)
+	if err != nil {
+		return err
+	}
+
+	field := ownerField(s)
+	if field == nil {
+		return nil
+	}
+
+	session, _ := SessionFrom(ctx)
+	if session.Identity == nil {
+		return errNoOwner
+	}
+
+	value := elem(obj)
+
+	if _, zero := field.ValueOf(ctx, value); !zero && session.Identity.HasRole(adminRole) {
+		return nil
+	}
+
+	return field.Set(ctx, value, session.Identity.UserID)
+}
+
+// checkOwner verifies the owner field of obj is unchanged from old.
+func checkOwner(ctx context.Context, obj any, old any) error {
+
+	s, err := parseSchema(obj)
+	if err != nil {
+		return err
+	}
+
+	field := ownerField(s)
+	if field == nil {
+		return nil
+	}
+
+	value, _ := field.ValueOf(ctx, elem(obj))
+	oldValue, _ := field.ValueOf(ctx, elem(old))
+
+	if !reflect.DeepEqual(value, oldValue) {
+		return data.FieldValidationErrorNew(jsonName(field), data.CodeReadOnly, "Owner cannot be changed")
+	}
+
+	return nil
+}
+
+// elem dereferences obj down to the struct it points to.
+func elem(obj any) reflect.Value {
+
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+
+	return value
+}
@@ -0,0 +1,455 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOwnerList(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	req, err := http.NewRequest("GET", "/auth/memo/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-Paging-Total"))
+
+	var slice []Memo
+	json.NewDecoder(rec.Body).Decode(&slice)
+
+	assert.Equal(t, 2, len(slice))
+	assert.Equal(t, 1, slice[0].ID)
+	assert.Equal(t, 3, slice[1].ID)
+
+	req.Header.Set("X-Access-Token", "admin-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "3", rec.Header().Get("X-Paging-Total"))
+}
+
+func TestOwnerRetrieve(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	req, err := http.NewRequest("GET", "/auth/memo/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req, err = http.NewRequest("GET", "/auth/memo/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req.Header.Set("X-Access-Token", "admin-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestOwnerCreate(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	req, err := http.NewRequest("POST", "/auth/memo/", strings.NewReader("{\"title\":\"fourth\",\"owner\":\"b\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var memo Memo
+	db.First(&memo, 4)
+
+	assert.Equal(t, "a", memo.Owner)
+
+	req, err = http.NewRequest("POST", "/auth/memo/", strings.NewReader("{\"title\":\"fifth\",\"owner\":\"c\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("X-Access-Token", "admin-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var other Memo
+	db.First(&other, 5)
+
+	assert.Equal(t, "c", other.Owner)
+
+	req, err = http.NewRequest("POST", "/auth/memo/", strings.NewReader("{\"title\":\"sixth\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("X-Access-Token", "admin-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var own Memo
+	db.First(&own, 6)
+
+	assert.Equal(t, "b", own.Owner)
+}
+
+func TestOwnerCreateAnonymous(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	req, err := http.NewRequest("POST", "/memo/", strings.NewReader("{\"title\":\"fourth\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := httptest.NewRecorder()
+
+	Create[*Memo](rec, req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+
+	var count int64
+	db.Model(&Memo{}).Count(&count)
+
+	assert.Equal(t, int64(3), count)
+}
+
+func TestOwnerUpdate(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	req, err := http.NewRequest("PATCH", "/auth/memo/1", strings.NewReader("{\"owner\":\"b\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "{\"code\":1002,\"message\":\"Owner cannot be changed\",\"field\":\"owner\"}", rec.Body.String())
+
+	req, err = http.NewRequest("PATCH", "/auth/memo/2", strings.NewReader("{\"title\":\"changed\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req, err = http.NewRequest("PATCH", "/auth/memo/1", strings.NewReader("{\"title\":\"changed\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var memo Memo
+	db.First(&memo, 1)
+
+	assert.Equal(t, "changed", memo.Title)
+	assert.Equal(t, "a", memo.Owner)
+}
+
+func TestOwnerDelete(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	req, err := http.NewRequest("DELETE", "/auth/memo/2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	req.Header.Set("X-Access-Token", "admin-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	req, err = http.NewRequest("DELETE", "/auth/memo/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	var count int64
+	db.Model(&Memo{}).Count(&count)
+
+	assert.Equal(t, int64(1), count)
+}
+
+func TestOwnerExpand(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	req, err := http.NewRequest("GET", "/auth/memo/1?expand=items", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var memo Memo
+	json.NewDecoder(rec.Body).Decode(&memo)
+
+	assert.Equal(t, []MemoItem{{ID: 1, Memo: 1, Text: "mine", Owner: "a"}}, memo.Items)
+
+	req, err = http.NewRequest("GET", "/auth/memo/?expand=items(text)", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var slice []Memo
+	json.NewDecoder(rec.Body).Decode(&slice)
+
+	assert.Equal(t, 2, len(slice))
+	assert.Equal(t, []MemoItem{{ID: 1, Text: "mine"}}, slice[0].Items)
+
+	req, err = http.NewRequest("GET", "/auth/memo/1?expand=items", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "admin-token")
+
+	rec = serveHTTPAuth(req)
+
+	var all Memo
+	json.NewDecoder(rec.Body).Decode(&all)
+
+	assert.Equal(t, 2, len(all.Items))
+}
+
+func TestOwnerRefs(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	for body, code := range map[string]int{
+		"{\"id_memo\":2,\"text\":\"text\"}":  http.StatusUnprocessableEntity,
+		"{\"id_memo\":99,\"text\":\"text\"}": http.StatusUnprocessableEntity,
+		"{\"id_memo\":1,\"text\":\"text\"}":  http.StatusCreated,
+	} {
+
+		req, err := http.NewRequest("POST", "/auth/memo_item/", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Add("X-Access-Token", "123-token")
+
+		rec := serveHTTPAuth(req)
+
+		assert.Equal(t, code, rec.Code, body)
+
+		if code == http.StatusUnprocessableEntity {
+			assert.Equal(t, "{\"code\":1001,\"message\":\"Referenced row not found\",\"field\":\"id_memo\"}", rec.Body.String())
+		}
+	}
+}
+
+func TestOwnerLinks(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	link := func(method string, url string, body string) int {
+
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Add("X-Access-Token", "123-token")
+
+		return serveHTTPAuth(req).Code
+	}
+
+	assert.Equal(t, http.StatusNotFound, link("PUT", "/auth/memo/1/label/2", ""))
+	assert.Equal(t, http.StatusNoContent, link("PUT", "/auth/memo/1/label/1", ""))
+	assert.Equal(t, http.StatusNotFound, link("PUT", "/auth/memo/1/label/", "[1,2]"))
+	assert.Equal(t, http.StatusNoContent, link("PUT", "/auth/memo/1/label/", "[1]"))
+
+	var labels []Label
+	db.Model(&Memo{ID: 1}).Association("Labels").Find(&labels)
+
+	assert.Equal(t, 1, len(labels))
+	assert.Equal(t, 1, labels[0].ID)
+
+	// the links to the labels of others are kept on replace
+	db.Model(&Memo{ID: 1}).Association("Labels").Append(&Label{ID: 2})
+
+	assert.Equal(t, http.StatusNoContent, link("PUT", "/auth/memo/1/label/", "[]"))
+
+	labels = nil
+	db.Model(&Memo{ID: 1}).Association("Labels").Find(&labels)
+
+	assert.Equal(t, 1, len(labels))
+	assert.Equal(t, 2, labels[0].ID)
+}
+
+func TestOwnerNested(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupMemos()
+
+	for _, test := range []struct {
+		method string
+		url    string
+		body   string
+		code   int
+	}{
+		{"POST", "/auth/memo/", "{\"title\":\"new\",\"items\":[{\"text\":\"new\",\"owner\":\"b\"}]}", http.StatusCreated},
+		{"PATCH", "/auth/memo/1", "{\"items\":[{\"id_memo_item\":1,\"owner\":\"b\"}]}", http.StatusUnprocessableEntity},
+		{"PATCH", "/auth/memo/1", "{\"items\":[{\"id_memo_item\":1,\"text\":\"changed\"},{\"text\":\"added\",\"owner\":\"b\"}]}", http.StatusOK},
+	} {
+
+		req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Add("X-Access-Token", "123-token")
+
+		rec := serveHTTPAuth(req)
+
+		assert.Equal(t, test.code, rec.Code, test.body)
+	}
+
+	var items []MemoItem
+	db.Order("id").Find(&items)
+
+	assert.Equal(t, 4, len(items))
+	assert.Equal(t, MemoItem{ID: 1, Memo: 1, Text: "changed", Owner: "a"}, items[0])
+	assert.Equal(t, MemoItem{ID: 3, Memo: 4, Text: "new", Owner: "a"}, items[2])
+	assert.Equal(t, MemoItem{ID: 4, Memo: 1, Text: "added", Owner: "a"}, items[3])
+}
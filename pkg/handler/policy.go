@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"gopkg.in/yaml.v3"
+)
+
+type Operation string
+
+const (
+	OpList     Operation = "list"
+	OpRetrieve Operation = "retrieve"
+	OpCreate   Operation = "create"
+	OpUpdate   Operation = "update"
+	OpDelete   Operation = "delete"
+)
+
+func (op Operation) Valid() bool {
+	switch op {
+	case OpList, OpRetrieve, OpCreate, OpUpdate, OpDelete:
+		return true
+	}
+	return false
+}
+
+// Policy maps the resources, by table name, to the roles allowed each
+// operation on them, "*" allowing anyone. Resources left out are open to
+// anyone and operations left out of a resource to no one.
+type Policy map[string]map[Operation][]string
+
+var policy Policy
+
+func SetPolicy(_policy Policy) {
+	policy = _policy
+}
+
+// LoadPolicy reads a policy from the YAML or, for a .json extension, JSON
+// file at path.
+func LoadPolicy(path string) (Policy, error) {
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var loaded Policy
+
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(bytes, &loaded)
+	} else {
+		err = yaml.Unmarshal(bytes, &loaded)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for resource, operations := range loaded {
+		for op := range operations {
+			if !op.Valid() {
+				return nil, fmt.Errorf("invalid operation %s on %s", op, resource)
+			}
+		}
+	}
+
+	return loaded, nil
+}
+
+// Allows tells whether identity, nil for anonymous requesters, may run op
+// on resource.
+func (p Policy) Allows(resource string, op Operation, identity *data.Identity) bool {
+
+	operations, ok := p[resource]
+	if !ok {
+		return true
+	}
+
+	for _, role := range operations[op] {
+		if role == "*" || identity.HasRole(role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// problem is an RFC 7807 problem details body.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail})
+}
+
+// scopeAllows tells whether any of scopes, resource:operation pairs with
+// "*" matching any of either, allows op on resource.
+func scopeAllows(scopes []string, resource string, op Operation) bool {
+
+	for _, scope := range scopes {
+
+		scopeResource, scopeOp, _ := strings.Cut(scope, ":")
+
+		if (scopeResource == "*" || scopeResource == resource) && (scopeOp == "*" || scopeOp == string(op)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// authorizeResource tells whether the session of r may run op on resource,
+// by the policy and the scopes of its identity, writing a problem when it
+// may not.
+func authorizeResource(w http.ResponseWriter, r *http.Request, resource string, op Operation) bool {
+
+	session, _ := SessionFrom(r.Context())
+
+	scoped := session.Identity == nil || session.Identity.Scopes == nil || scopeAllows(session.Identity.Scopes, resource, op)
+
+	if scoped && (policy == nil || policy.Allows(resource, op, session.Identity)) {
+		return true
+	}
+
+	writeProblem(w, http.StatusForbidden, fmt.Sprintf("%s on %s is not allowed", op, resource))
+
+	return false
+}
+
+// authorize tells whether the session of r may run op on T, writing the
+// status when it may not.
+func authorize[T any](w http.ResponseWriter, r *http.Request, op Operation) bool {
+
+	if session, _ := SessionFrom(r.Context()); policy == nil && (session.Identity == nil || session.Identity.Scopes == nil) {
+		return true
+	}
+
+	var obj T
+
+	s, err := parseSchema(&obj)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+
+	return authorizeResource(w, r, s.Table, op)
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyAnonymous(t *testing.T) {
+
+	SetPolicy(Policy{"dummies": {OpList: {"*"}, OpRetrieve: {"reader"}}})
+	defer SetPolicy(nil)
+
+	setupDb(2)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req, err = http.NewRequest("GET", "/dummy/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+
+	var body problem
+	json.NewDecoder(rec.Body).Decode(&body)
+
+	assert.Equal(t, problem{Type: "about:blank", Title: "Forbidden", Status: http.StatusForbidden, Detail: "retrieve on dummies is not allowed"}, body)
+
+	req, err = http.NewRequest("POST", "/dummy/", strings.NewReader("{\"title\":\"title\",\"valid\":true}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	var count int64
+	db.Model(&Dummy{}).Count(&count)
+
+	assert.Equal(t, int64(2), count)
+}
+
+func TestPolicyUndeclaredResource(t *testing.T) {
+
+	SetPolicy(Policy{"dummies": {}})
+	defer SetPolicy(nil)
+
+	setupDb(1)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy_default/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestPolicyRoles(t *testing.T) {
+
+	SetAuthenticator(&MockIdentifier{})
+	defer SetAuthenticator(&MockAuth{})
+
+	SetPolicy(Policy{"dummies": {OpRetrieve: {"reader"}, OpDelete: {"admin"}}})
+	defer SetPolicy(nil)
+
+	setupDb(1)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/auth/dummy/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req, err = http.NewRequest("DELETE", "/auth/dummy/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Add("X-Access-Token", "123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+}
+
+func TestPolicyNestedParent(t *testing.T) {
+
+	SetPolicy(Policy{"sub_dummies": {OpRetrieve: {"admin"}}})
+	defer SetPolicy(nil)
+
+	setupDb(1)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/1/subdummy/1/subsubdummy/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	var body problem
+	json.NewDecoder(rec.Body).Decode(&body)
+
+	assert.Equal(t, "retrieve on sub_dummies is not allowed", body.Detail)
+}
+
+func TestLoadPolicy(t *testing.T) {
+
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "policy.yaml")
+	os.WriteFile(path, []byte("dummies:\n  list: [\"*\"]\n  delete: [admin]\n"), 0600)
+
+	loaded, err := LoadPolicy(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Policy{"dummies": {OpList: {"*"}, OpDelete: {"admin"}}}, loaded)
+
+	path = filepath.Join(dir, "policy.json")
+	os.WriteFile(path, []byte("{\"dummies\":{\"retrieve\":[\"reader\"]}}"), 0600)
+
+	loaded, err = LoadPolicy(path)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Policy{"dummies": {OpRetrieve: {"reader"}}}, loaded)
+
+	path = filepath.Join(dir, "invalid.yaml")
+	os.WriteFile(path, []byte("dummies:\n  remove: [admin]\n"), 0600)
+
+	_, err = LoadPolicy(path)
+
+	assert.NotNil(t, err)
+
+	_, err = LoadPolicy(filepath.Join(dir, "missing.yaml"))
+
+	assert.NotNil(t, err)
+}
+
+func TestPolicyExpand(t *testing.T) {
+
+	SetPolicy(Policy{"sub_dummies": {OpRetrieve: {"*"}}})
+	defer SetPolicy(nil)
+
+	setupDb(1)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req, err = http.NewRequest("GET", "/dummy/1?expand=children", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	var body problem
+	json.NewDecoder(rec.Body).Decode(&body)
+
+	assert.Equal(t, "list on sub_dummies is not allowed", body.Detail)
+
+	req, err = http.NewRequest("GET", "/dummy/?expand=children", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var models = map[string]reflect.Type{}
+
+// RegisterModel makes T referable by its type name in `crud:"ref=Name"`
+// tags.
+func RegisterModel[T any]() {
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	models[t.Name()] = t
+}
+
+// checkRefs verifies the rows referred to by the fields of obj tagged as
+// `crud:"ref=Name"` exist, are owned by the session of ctx when their model
+// has an owner field and, when their model is a data.ReadValidator, can be
+// read, skipping nil or NULL fields and those unchanged from old, when
+// given. Rows that cannot be read are reported as inexistent.
+func checkRefs(ctx context.Context, tx *gorm.DB, obj any, old any) error {
+
+	s, err := parseSchema(obj)
+	if err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Pointer {
+		value = value.Elem()
+	}
+
+	for _, field := range s.Fields {
+
+		name, ok := parseTag(field.Tag)["ref"]
+		if !ok {
+			continue
+		}
+
+		model, ok := models[name]
+		if !ok {
+			return fmt.Errorf("unregistered model %s", name)
+		}
+
+		// zero keys, unlike nil ones, refer to rows too
+		if fieldValue := field.ReflectValueOf(ctx, value); (fieldValue.Kind() == reflect.Pointer || fieldValue.Kind() == reflect.Interface) && fieldValue.IsNil() {
+			continue
+		}
+
+		key, _ := field.ValueOf(ctx, value)
+
+		if old != nil {
+
+			oldValue := reflect.ValueOf(old)
+			for oldValue.Kind() == reflect.Pointer {
+				oldValue = oldValue.Elem()
+			}
+
+			if oldKey, _ := field.ValueOf(ctx, oldValue); reflect.DeepEqual(key, oldKey) {
+				continue
+			}
+		}
+
+		if valuer, ok := key.(driver.Valuer); ok {
+			if key, err = valuer.Value(); err != nil || key == nil {
+				continue
+			}
+		}
+
+		row := reflect.New(model)
+
+		refSchema, err := parseSchema(row.Interface())
+		if err != nil {
+			return err
+		}
+
+		if len(refSchema.PrimaryFields) != 1 {
+			return fmt.Errorf("model %s has no single primary key", name)
+		}
+
+		column := clause.Column{Table: clause.CurrentTable, Name: refSchema.PrimaryFields[0].DBName}
+
+		res := ownerScopeOf(ctx, refSchema)(tx).Where(clause.Eq{Column: column, Value: key}).Limit(1).Find(row.Interface())
+		if res.Error != nil {
+			return res.Error
+		}
+
+		invalid := res.RowsAffected == 0
+
+		if validator, ok := row.Interface().(data.ReadValidator); ok && !invalid {
+			invalid = validator.ValidateRead(ctx) != nil
+		}
+
+		if invalid {
+			return data.FieldValidationErrorNew(jsonName(field), data.CodeInvalidReference, "Referenced row not found")
+		}
+	}
+
+	return nil
+}
+
+// writeRefsError writes the status of err, returned by checkRefs.
+func writeRefsError(w http.ResponseWriter, err error) {
+
+	var invalid data.ValidationError
+
+	if errors.As(err, &invalid) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func refsRequest(t *testing.T, method string, url string, body string) (int, string) {
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	rec := serveHTTP(req)
+
+	return rec.Code, rec.Body.String()
+}
+
+func TestRefsCreate(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	db.Create(&Dummy{ID: 3, Title: "title", Valid: false})
+
+	code, body := refsRequest(t, "POST", "/subdummy/", "{\"title\":\"title\",\"valid\":true,\"id_dummy\":9}")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "{\"code\":1001,\"message\":\"Referenced row not found\",\"field\":\"id_dummy\"}", body)
+
+	// rows that cannot be read are not told apart from inexistent ones
+	code, _ = refsRequest(t, "POST", "/subdummy/", "{\"title\":\"title\",\"valid\":true,\"id_dummy\":3}")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+
+	// zero keys are checked, unlike null ones
+	code, body = refsRequest(t, "POST", "/subdummy/", "{\"title\":\"title\",\"valid\":true,\"id_dummy\":0}")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "{\"code\":1001,\"message\":\"Referenced row not found\",\"field\":\"id_dummy\"}", body)
+
+	code, _ = refsRequest(t, "POST", "/subdummy/", "{\"title\":\"title\",\"valid\":true,\"id_dummy\":2}")
+	assert.Equal(t, http.StatusCreated, code)
+
+	code, _ = refsRequest(t, "POST", "/note/", "{\"text\":\"text\",\"id_dummy\":null}")
+	assert.Equal(t, http.StatusCreated, code)
+
+	code, _ = refsRequest(t, "POST", "/note/", "{\"text\":\"text\",\"id_dummy\":9}")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+}
+
+func TestRefsUpdate(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	one := 1
+	db.Create(&Note{ID: 1, Text: "text", Dummy: &one})
+	db.Model(&Dummy{ID: 1}).Update("valid", false)
+
+	// unchanged references are not checked again
+	code, _ := refsRequest(t, "PATCH", "/note/1", "{\"text\":\"text_new\"}")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, body := refsRequest(t, "PATCH", "/note/1", "{\"id_dummy\":9}")
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "{\"code\":1001,\"message\":\"Referenced row not found\",\"field\":\"id_dummy\"}", body)
+
+	code, _ = refsRequest(t, "PATCH", "/note/1", "{\"id_dummy\":2}")
+	assert.Equal(t, http.StatusOK, code)
+
+	var note Note
+	db.First(&note, 1)
+
+	assert.Equal(t, "text_new", note.Text)
+	assert.Equal(t, 2, *note.Dummy)
+}
+
+func TestRefsChildren(t *testing.T) {
+
+	setupDb(2)
+	defer destroyDb()
+
+	code := writeChildren(t, "POST", "/dummy/", "{\"title\":\"title\",\"valid\":true,\"children\":[{\"title\":\"child\",\"valid\":true}]}")
+	assert.Equal(t, http.StatusCreated, code)
+
+	var child SubDummy
+	db.Last(&child)
+
+	assert.Equal(t, "child", child.Title)
+	assert.Equal(t, 3, child.Dummy)
+}
@@ -0,0 +1,429 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+type SearchField struct {
+	Name   string
+	Column string
+	Weight float64
+}
+
+type SearchTarget struct {
+	Table      string
+	PrimaryKey string
+	// Fields lists every searchable text field of the resource
+	Fields []SearchField
+	// Only restricts the search to these columns when not empty
+	Only []string
+}
+
+// Searched returns the fields the search is restricted to.
+func (t SearchTarget) Searched() []SearchField {
+
+	if len(t.Only) == 0 {
+		return t.Fields
+	}
+
+	var fields []SearchField
+
+	for _, field := range t.Fields {
+		for _, column := range t.Only {
+			if field.Column == column {
+				fields = append(fields, field)
+				break
+			}
+		}
+	}
+
+	return fields
+}
+
+// SearchStrategy matches the text fields of a resource against the search
+// queries given to List.
+type SearchStrategy interface {
+	// Match returns the condition selecting the rows that match query.
+	Match(tx *gorm.DB, target SearchTarget, query string) clause.Expression
+	// Rank returns an ORDER BY expression sorting by relevance, or nil.
+	Rank(tx *gorm.DB, target SearchTarget, queries []string) clause.Expression
+}
+
+var searchStrategy SearchStrategy = LikeSearch{}
+
+func SetSearchStrategy(_searchStrategy SearchStrategy) {
+	searchStrategy = _searchStrategy
+}
+
+// searchTarget collects the text fields of s, honouring the crud tag:
+// `search` restricts the search to the tagged fields, `nosearch` excludes a
+// field and `weight=N` sets its relevance weight.
+func searchTarget(s *schema.Schema) SearchTarget {
+
+	target := SearchTarget{Table: s.Table}
+
+	if s.PrioritizedPrimaryField != nil {
+		target.PrimaryKey = s.PrioritizedPrimaryField.DBName
+	}
+
+	for _, field := range searchableFields(s) {
+		if isText(field) {
+			target.Fields = append(target.Fields, SearchField{
+				Name:   field.Name,
+				Column: field.DBName,
+				Weight: tagFloat(field.Tag, "weight", 1),
+			})
+		}
+	}
+
+	return target
+}
+
+func searchableFields(s *schema.Schema) []*schema.Field {
+
+	optIn := false
+	for _, field := range s.Fields {
+		if tagHas(field.Tag, "search") {
+			optIn = true
+			break
+		}
+	}
+
+	var fields []*schema.Field
+
+	for _, field := range s.Fields {
+		if field.DBName == "" || tagHas(field.Tag, "nosearch") || (optIn && !tagHas(field.Tag, "search")) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+func isText(field *schema.Field) bool {
+	typeName := field.FieldType.Name()
+	return typeName == "string" || typeName == "NullString"
+}
+
+// typedMatch matches query against a non text field according to its type:
+// numbers by equality, booleans by true or false and times by the period
+// the query spells, e.g. 2024-05 or 2024-05-01..2024-05-15.
+func typedMatch(field *schema.Field, query string) clause.Expression {
+
+	typeName := field.FieldType.Name()
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+
+	switch {
+	case strings.HasPrefix(typeName, "int") || strings.HasPrefix(typeName, "uint") || strings.HasPrefix(typeName, "NullInt"):
+		if value, err := strconv.Atoi(query); err == nil {
+			return clause.Eq{Column: column, Value: value}
+		}
+	case strings.HasPrefix(typeName, "float") || strings.HasPrefix(typeName, "NullFloat"):
+		if value, err := strconv.ParseFloat(query, 64); err == nil {
+			return clause.Eq{Column: column, Value: value}
+		}
+	case typeName == "bool" || typeName == "NullBool":
+		// only the words, a search for 1 should not match every true row
+		if value := strings.ToLower(query); value == "true" || value == "false" {
+			return clause.Eq{Column: column, Value: value == "true"}
+		}
+	case typeName == "Time" || typeName == "NullTime":
+		if from, to, ok := parsePeriod(query); ok {
+			return clause.And(clause.Gte{Column: column, Value: from}, clause.Lt{Column: column, Value: to})
+		}
+	}
+
+	return nil
+}
+
+var periodLayouts = []struct {
+	layout string
+	next   func(time.Time) time.Time
+}{
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01-02T15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02T15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+}
+
+// parsePeriod returns the half-open interval spelled by str, a date or time
+// at any precision of periodLayouts, or a range of two of them split by "..".
+func parsePeriod(str string) (time.Time, time.Time, bool) {
+
+	if start, end, found := strings.Cut(str, ".."); found {
+
+		from, _, ok := parsePeriod(start)
+		if !ok {
+			return from, from, false
+		}
+
+		_, to, ok := parsePeriod(end)
+
+		return from, to, ok && from.Before(to)
+	}
+
+	for _, period := range periodLayouts {
+		if t, err := time.Parse(period.layout, str); err == nil {
+			return t.UTC(), period.next(t).UTC(), true
+		}
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+func anyOf(exprs []clause.Expression) clause.Expression {
+
+	if len(exprs) == 1 {
+		return exprs[0]
+	}
+
+	return clause.Or(exprs...)
+}
+
+// LikeSearch matches every text field with a case-insensitive LIKE and has
+// no ranking. AccentInsensitive also ignores diacritics, which needs the
+// unaccent extension on Postgres and an unaccent function registered on
+// SQLite, e.g. data.Unaccent. On SQLite, whose lower function only folds
+// ascii, Casefold folds the case with a casefold function registered, e.g.
+// data.Casefold. On MySQL both are left to the collation of the columns,
+// or to Collation when set, e.g. utf8mb4_0900_ai_ci.
+type LikeSearch struct {
+	AccentInsensitive bool
+	Casefold          bool
+	Collation         string
+}
+
+// likeEscape escapes the LIKE wildcards in str with '!', which, unlike the
+// backslash, needs no escaping itself in any dialect.
+func likeEscape(str string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(str)
+}
+
+func (s LikeSearch) like(dialect string) string {
+
+	switch dialect {
+	case "postgres":
+		if s.AccentInsensitive {
+			return "lower(unaccent(?::text)) LIKE lower(unaccent(?)) ESCAPE '!'"
+		}
+		return "lower(?::text) LIKE lower(?) ESCAPE '!'"
+	case "mysql":
+		if s.Collation != "" {
+			return "? COLLATE " + s.Collation + " LIKE ? ESCAPE '!'"
+		}
+		return "? LIKE ? ESCAPE '!'"
+	}
+
+	lower := "lower"
+	if s.Casefold {
+		lower = "casefold"
+	}
+
+	// sqlite lower() only folds ascii, unaccenting first leaves little else
+	if s.AccentInsensitive {
+		return lower + "(unaccent(?)) LIKE " + lower + "(unaccent(?)) ESCAPE '!'"
+	}
+	return lower + "(?) LIKE " + lower + "(?) ESCAPE '!'"
+}
+
+func (s LikeSearch) Match(tx *gorm.DB, target SearchTarget, query string) clause.Expression {
+
+	like := s.like(tx.Dialector.Name())
+	pattern := "%" + likeEscape(query) + "%"
+
+	var exprs []clause.Expression
+
+	for _, field := range target.Searched() {
+		exprs = append(exprs, clause.Expr{SQL: like, Vars: []any{clause.Column{Table: clause.CurrentTable, Name: field.Column}, pattern}})
+	}
+
+	return anyOf(exprs)
+}
+
+func (LikeSearch) Rank(tx *gorm.DB, target SearchTarget, queries []string) clause.Expression {
+	return nil
+}
+
+// FTS5Search searches the SQLite FTS5 table created by Migrate and ranks
+// the results with bm25, using the field weights. It requires go-sqlite3 to
+// be built with the sqlite_fts5 tag.
+type FTS5Search struct{}
+
+func ftsTable(target SearchTarget) string {
+	return target.Table + "_fts"
+}
+
+// ftsQuery quotes every term so user input is never parsed as FTS5 syntax,
+// keeping prefix matching on each of them, and applies the column filter.
+func ftsQuery(target SearchTarget, query string) string {
+
+	var terms []string
+
+	for _, term := range strings.Fields(query) {
+		terms = append(terms, `"`+strings.ReplaceAll(term, `"`, `""`)+`"*`)
+	}
+
+	if len(target.Only) > 0 {
+		return "{" + strings.Join(target.Only, " ") + "} : (" + strings.Join(terms, " ") + ")"
+	}
+
+	return strings.Join(terms, " ")
+}
+
+func (FTS5Search) Match(tx *gorm.DB, target SearchTarget, query string) clause.Expression {
+
+	table := clause.Table{Name: ftsTable(target)}
+
+	return clause.Expr{
+		SQL:  "? IN (SELECT rowid FROM ? WHERE ? MATCH ?)",
+		Vars: []any{clause.Column{Table: clause.CurrentTable, Name: target.PrimaryKey}, table, table, ftsQuery(target, query)},
+	}
+}
+
+func (FTS5Search) Rank(tx *gorm.DB, target SearchTarget, queries []string) clause.Expression {
+
+	table := clause.Table{Name: ftsTable(target)}
+
+	var matches []string
+	for _, query := range queries {
+		matches = append(matches, "("+ftsQuery(target, query)+")")
+	}
+
+	weights := ""
+	for _, field := range target.Fields {
+		weights += fmt.Sprintf(", %g", field.Weight)
+	}
+
+	return clause.Expr{
+		SQL:  fmt.Sprintf("(SELECT bm25(?%s) FROM ? WHERE ? MATCH ? AND rowid = ?)", weights),
+		Vars: []any{table, table, table, strings.Join(matches, " OR "), clause.Column{Table: clause.CurrentTable, Name: target.PrimaryKey}},
+	}
+}
+
+// Migrate creates the external content FTS5 table indexing the text fields
+// of model, together with the triggers keeping it in sync with the model
+// table, and indexes the rows already there.
+func (FTS5Search) Migrate(tx *gorm.DB, model any) error {
+
+	stmt := &gorm.Statement{DB: tx}
+
+	err := stmt.Parse(model)
+	if err != nil {
+		return err
+	}
+
+	target := searchTarget(stmt.Schema)
+	if len(target.Fields) == 0 {
+		return fmt.Errorf("no text fields to index in %s", target.Table)
+	}
+
+	fts := ftsTable(target)
+
+	var columns, news, olds []string
+	for _, field := range target.Fields {
+		columns = append(columns, field.Column)
+		news = append(news, "new."+field.Column)
+		olds = append(olds, "old."+field.Column)
+	}
+
+	cols := strings.Join(columns, ", ")
+	insert := fmt.Sprintf("INSERT INTO %s(rowid, %s) VALUES (new.%s, %s);", fts, cols, target.PrimaryKey, strings.Join(news, ", "))
+	remove := fmt.Sprintf("INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.%s, %s);", fts, fts, cols, target.PrimaryKey, strings.Join(olds, ", "))
+
+	statements := []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='%s')", fts, cols, target.Table, target.PrimaryKey),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ai AFTER INSERT ON %s BEGIN %s END", fts, target.Table, insert),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_ad AFTER DELETE ON %s BEGIN %s END", fts, target.Table, remove),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s_au AFTER UPDATE ON %s BEGIN %s %s END", fts, target.Table, remove, insert),
+		fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", fts, fts),
+	}
+
+	for _, statement := range statements {
+		err = tx.Exec(statement).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// PostgresSearch matches a tsvector built from the text fields, each one
+// weighted A to D according to its weight, and ranks with ts_rank.
+type PostgresSearch struct {
+	// Config is the text search configuration, "simple" when empty
+	Config string
+	// Column is a stored tsvector column to use instead of building it
+	Column string
+}
+
+func (s PostgresSearch) config() string {
+
+	if s.Config == "" {
+		return "simple"
+	}
+
+	return s.Config
+}
+
+func tsWeight(weight float64) string {
+
+	switch {
+	case weight >= 4:
+		return "A"
+	case weight >= 3:
+		return "B"
+	case weight >= 2:
+		return "C"
+	}
+
+	return "D"
+}
+
+func (s PostgresSearch) document(target SearchTarget) clause.Expression {
+
+	if s.Column != "" {
+		return clause.Expr{SQL: "?", Vars: []any{clause.Column{Table: clause.CurrentTable, Name: s.Column}}}
+	}
+
+	var parts []string
+	var vars []any
+
+	for _, field := range target.Searched() {
+		parts = append(parts, fmt.Sprintf("setweight(to_tsvector(?::regconfig, coalesce(?::text, '')), '%s')", tsWeight(field.Weight)))
+		vars = append(vars, s.config(), clause.Column{Table: clause.CurrentTable, Name: field.Column})
+	}
+
+	return clause.Expr{SQL: "(" + strings.Join(parts, " || ") + ")", Vars: vars}
+}
+
+func (s PostgresSearch) query(queries []string) clause.Expression {
+
+	var parts []string
+	var vars []any
+
+	for _, query := range queries {
+		parts = append(parts, "websearch_to_tsquery(?::regconfig, ?)")
+		vars = append(vars, s.config(), query)
+	}
+
+	return clause.Expr{SQL: "(" + strings.Join(parts, " || ") + ")", Vars: vars}
+}
+
+func (s PostgresSearch) Match(tx *gorm.DB, target SearchTarget, query string) clause.Expression {
+	return clause.Expr{SQL: "? @@ ?", Vars: []any{s.document(target), s.query([]string{query})}}
+}
+
+func (s PostgresSearch) Rank(tx *gorm.DB, target SearchTarget, queries []string) clause.Expression {
+	return clause.Expr{SQL: "ts_rank(?, ?) DESC", Vars: []any{s.document(target), s.query(queries)}}
+}
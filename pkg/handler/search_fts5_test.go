@@ -0,0 +1,76 @@
+//go:build sqlite_fts5
+
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchFTS5(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	err := FTS5Search{}.Migrate(db, &Article{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetSearchStrategy(FTS5Search{})
+	defer SetSearchStrategy(LikeSearch{})
+
+	// rows created after the migration are indexed by the triggers
+	db.Create(&Article{ID: 4, Title: "other", Body: "gorm", Secret: "gorm"})
+	db.Model(&Article{ID: 3}).Update("body", "gorm")
+
+	req, err := http.NewRequest("GET", "/article/?search=gor", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "4", rec.Header().Get("X-Paging-Total"))
+
+	var slice []Article
+	err = json.NewDecoder(rec.Body).Decode(&slice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the title weighs more than the body
+	assert.Equal(t, 4, len(slice))
+	assert.Equal(t, 1, slice[0].ID)
+
+	req, err = http.NewRequest("GET", "/article/?search=gorm&sort=ID", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	slice = []Article{}
+	err = json.NewDecoder(rec.Body).Decode(&slice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, []int{1, 2, 3, 4}, []int{slice[0].ID, slice[1].ID, slice[2].ID, slice[3].ID})
+
+	req, err = http.NewRequest("GET", "/article/?search=gorm&search_fields=title", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Paging-Total"))
+}
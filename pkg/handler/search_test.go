@@ -0,0 +1,269 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func init() {
+	sql.Register("sqlite3_unaccent", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			err := conn.RegisterFunc("unaccent", data.Unaccent, true)
+			if err != nil {
+				return err
+			}
+			return conn.RegisterFunc("casefold", data.Casefold, true)
+		},
+	})
+}
+
+func TestSearchLikeNoSearchTag(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	req, err := http.NewRequest("GET", "/article/?search=search", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var slice []Article
+	err = json.NewDecoder(rec.Body).Decode(&slice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 1, len(slice))
+	assert.Equal(t, 1, slice[0].ID)
+}
+
+func TestSearchPostgresQuery(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	SetSearchStrategy(PostgresSearch{Config: "english"})
+	defer SetSearchStrategy(LikeSearch{})
+
+	// the sqlite dialector quotes the strings with double quotes
+	query := db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		tx, err := createSearchQuery(tx.Model(&Article{}), &Article{}, []string{"gorm tips"}, nil, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tx.Find(&[]Article{})
+	})
+
+	assert.True(t, strings.Contains(query, "setweight(to_tsvector(\"english\"::regconfig, coalesce(`articles`.`title`::text, '')), 'C')"))
+	assert.True(t, strings.Contains(query, "setweight(to_tsvector(\"english\"::regconfig, coalesce(`articles`.`body`::text, '')), 'D')"))
+	assert.True(t, strings.Contains(query, "@@ (websearch_to_tsquery(\"english\"::regconfig, \"gorm tips\"))"))
+	assert.True(t, strings.Contains(query, "ORDER BY ts_rank("))
+	assert.False(t, strings.Contains(query, "secret"))
+}
+
+func TestSearchLikeCaseInsensitive(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/dummy/?search=TITLE2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Paging-Total"))
+}
+
+func TestSearchLikeEscapesWildcards(t *testing.T) {
+
+	setupDb(5)
+	defer destroyDb()
+
+	for _, query := range []string{"_itle", "%25", "t%25e"} {
+
+		req, err := http.NewRequest("GET", "/dummy/?search="+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	}
+}
+
+func TestSearchLikeAccentInsensitive(t *testing.T) {
+
+	conn, err := gorm.Open(sqlite.Dialector{DriverName: "sqlite3_unaccent", DSN: ":memory:"}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetDatabase(conn)
+	defer destroyDb()
+
+	db.AutoMigrate(&Article{})
+	db.Create(&Article{ID: 1, Title: "Café Crème"})
+	db.Create(&Article{ID: 2, Title: "Cafeteria"})
+	db.Create(&Article{ID: 3, Title: "Crepe"})
+
+	SetSearchStrategy(LikeSearch{AccentInsensitive: true})
+	defer SetSearchStrategy(LikeSearch{})
+
+	for query, total := range map[string]string{"cafe": "2", "CAFÉ": "2", "creme": "1", "crème": "1", "cre": "2"} {
+
+		req, err := http.NewRequest("GET", "/article/?search="+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, query)
+		assert.Equal(t, total, rec.Header().Get("X-Paging-Total"), query)
+	}
+}
+
+func TestSearchLikeCasefold(t *testing.T) {
+
+	conn, err := gorm.Open(sqlite.Dialector{DriverName: "sqlite3_unaccent", DSN: ":memory:"}, &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetDatabase(conn)
+	defer destroyDb()
+
+	db.AutoMigrate(&Article{})
+	db.Create(&Article{ID: 1, Title: "École"})
+	db.Create(&Article{ID: 2, Title: "Ecole"})
+
+	defer SetSearchStrategy(LikeSearch{})
+
+	for _, test := range []struct {
+		strategy LikeSearch
+		query    string
+		code     int
+		total    string
+	}{
+		{LikeSearch{}, "école", http.StatusNotFound, ""},
+		{LikeSearch{Casefold: true}, "école", http.StatusOK, "1"},
+		{LikeSearch{Casefold: true}, "ÉCOLE", http.StatusOK, "1"},
+		{LikeSearch{Casefold: true, AccentInsensitive: true}, "école", http.StatusOK, "2"},
+	} {
+
+		SetSearchStrategy(test.strategy)
+
+		req, err := http.NewRequest("GET", "/article/?search="+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, test.code, rec.Code, test)
+		assert.Equal(t, test.total, rec.Header().Get("X-Paging-Total"), test)
+	}
+}
+
+func TestSearchFields(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	for query, total := range map[string]string{"search=golang": "2", "search=golang&search_fields=title": "1", "search=golang&search_fields=Title,body": "2", "search=1&search_fields=id_article,title": "1"} {
+
+		req, err := http.NewRequest("GET", "/article/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, query)
+		assert.Equal(t, total, rec.Header().Get("X-Paging-Total"), query)
+	}
+}
+
+func TestSearchFieldsWrongField(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	req, err := http.NewRequest("GET", "/article/?search=golang&search_fields=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestSearchTyped(t *testing.T) {
+
+	setupDb(0)
+	defer destroyDb()
+
+	setupArticles()
+
+	for query, ids := range map[string][]int{
+		"search=true":                               {2},
+		"search=false&search_fields=draft":          {1, 3},
+		"search=2024":                               {1, 2, 3},
+		"search=2024-05":                            {1, 2},
+		"search=2024-05-02":                         {2},
+		"search=2024-05-01..2024-05-02":             {1, 2},
+		"search=2024-05-01T10:00":                   {1},
+		"search=2024-06&search_fields=reviewed_at":  {3},
+		"search=2024-06&search_fields=published_at": {},
+	} {
+
+		req, err := http.NewRequest("GET", "/article/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := serveHTTP(req)
+
+		if len(ids) == 0 {
+			assert.Equal(t, http.StatusNotFound, rec.Code, query)
+			continue
+		}
+
+		var slice []Article
+		err = json.NewDecoder(rec.Body).Decode(&slice)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found []int
+		for _, article := range slice {
+			found = append(found, article.ID)
+		}
+
+		assert.Equal(t, ids, found, query)
+	}
+}
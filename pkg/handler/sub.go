@@ -1,49 +1,161 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
+	"reflect"
 
 	"github.com/diogomattioli/crud/pkg/data"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm/schema"
 )
 
-func sub[T any, S any](w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request)) {
-	
-	vars, err := varsToJson(r)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	_, err = getObject[S](vars)
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		return
-	}
+// Parent is an ancestor of a nested resource, loaded from the route vars.
+type Parent struct {
+	model any
+	load  func(r *http.Request, vars []byte) (any, error)
+}
 
-	f(w, r)
+// ParentOf declares S as an ancestor of a nested resource.
+func ParentOf[S any]() Parent {
+	return Parent{model: new(S), load: func(r *http.Request, vars []byte) (any, error) {
+		obj, err := getObject[S](ownerScope[S](r)(db), vars)
+		return &obj, err
+	}}
 }
 
-func sub2[T any, S2 any, S any](w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request)) {
+// relationReferences returns the references of the relation declared
+// between parent and child, by either of them, through which child holds
+// the primary key of parent.
+func relationReferences(parent *schema.Schema, child *schema.Schema) []*schema.Reference {
 
-	vars, err := varsToJson(r)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
+	for _, s := range []*schema.Schema{child, parent} {
+		for _, rel := range s.Relationships.Relations {
+
+			var refs []*schema.Reference
+
+			for _, ref := range rel.References {
+				if ref.PrimaryKey != nil && ref.ForeignKey.Schema == child && ref.PrimaryKey.Schema == parent {
+					refs = append(refs, ref)
+				}
+			}
 
-	_, err = getObject[S](vars)
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		return
+			if len(refs) > 0 {
+				return refs
+			}
+		}
 	}
 
-	_, err = getObject[S2](vars)
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		return
+	return nil
+}
+
+// Nested wraps f, a handler of T, to run only when every parent, outermost
+// first, exists and belongs to the previous one through their declared
+// foreign keys. The foreign keys of T are then set to the innermost parent
+// in the route vars, so f is scoped to it. Parents or T without a foreign
+// key to the previous one make a misrouted request, answered with 500.
+func Nested[T any](f func(http.ResponseWriter, *http.Request), parents ...Parent) func(http.ResponseWriter, *http.Request) {
+	return nested[T](f, false, parents...)
+}
+
+// nested is Nested where, when legacy is set, parents or T without a
+// declared relation to the previous one are matched by their route vars
+// alone, as their plain foreign key columns are named as them.
+func nested[T any](f func(http.ResponseWriter, *http.Request), legacy bool, parents ...Parent) func(http.ResponseWriter, *http.Request) {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		vars, err := varsToJson(r)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		var previous reflect.Value
+		var previousSchema *schema.Schema
+
+		for _, parent := range parents {
+
+			s, err := parseSchema(parent.model)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			var refs []*schema.Reference
+
+			if previousSchema != nil {
+				refs = relationReferences(previousSchema, s)
+				if len(refs) == 0 && !legacy {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+
+			// the parents are retrieved on the way
+			if !authorizeResource(w, r, s.Table, OpRetrieve) {
+				return
+			}
+
+			obj, err := parent.load(r, vars)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			value := reflect.Indirect(reflect.ValueOf(obj))
+
+			for _, ref := range refs {
+				key, _ := ref.PrimaryKey.ValueOf(r.Context(), previous)
+				foreign, _ := ref.ForeignKey.ValueOf(r.Context(), value)
+				if fmt.Sprint(key) != fmt.Sprint(foreign) {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+			}
+
+			previous, previousSchema = value, s
+		}
+
+		if previousSchema != nil {
+
+			var obj T
+
+			s, err := parseSchema(&obj)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			refs := relationReferences(previousSchema, s)
+			if len(refs) == 0 && !legacy {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			routeVars := map[string]string{}
+			for key, value := range mux.Vars(r) {
+				routeVars[key] = value
+			}
+
+			for _, ref := range refs {
+				key, _ := ref.PrimaryKey.ValueOf(r.Context(), previous)
+				routeVars[jsonName(ref.ForeignKey)] = fmt.Sprint(key)
+			}
+
+			r = mux.SetURLVars(r, routeVars)
+		}
+
+		f(w, r)
 	}
+}
 
-	f(w, r)
+func sub[T any, S any](w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request)) {
+	nested[T](f, true, ParentOf[S]())(w, r)
+}
+
+func sub2[T any, S2 any, S any](w http.ResponseWriter, r *http.Request, f func(http.ResponseWriter, *http.Request)) {
+	nested[T](f, true, ParentOf[S](), ParentOf[S2]())(w, r)
 }
 
 func CreateSub[T data.CreateValidator, S any](w http.ResponseWriter, r *http.Request) {
@@ -84,4 +196,36 @@ func ListSub[T any, S any](w http.ResponseWriter, r *http.Request) {
 
 func ListSub2[T any, S2 any, S any](w http.ResponseWriter, r *http.Request) {
 	sub2[T, S2, S](w, r, List[T])
-}
\ No newline at end of file
+}
+
+func AggregateSub[T any, S any](w http.ResponseWriter, r *http.Request) {
+	sub[T, S](w, r, Aggregate[T])
+}
+
+func AggregateSub2[T any, S2 any, S any](w http.ResponseWriter, r *http.Request) {
+	sub2[T, S2, S](w, r, Aggregate[T])
+}
+
+func FacetSub[T any, S any](w http.ResponseWriter, r *http.Request) {
+	sub[T, S](w, r, Facet[T])
+}
+
+func FacetSub2[T any, S2 any, S any](w http.ResponseWriter, r *http.Request) {
+	sub2[T, S2, S](w, r, Facet[T])
+}
+
+func ExportSub[T any, S any](w http.ResponseWriter, r *http.Request) {
+	sub[T, S](w, r, Export[T])
+}
+
+func ExportSub2[T any, S2 any, S any](w http.ResponseWriter, r *http.Request) {
+	sub2[T, S2, S](w, r, Export[T])
+}
+
+func ImportSub[T data.CreateValidator, S any](w http.ResponseWriter, r *http.Request) {
+	sub[T, S](w, r, Import[T])
+}
+
+func ImportSub2[T data.CreateValidator, S2 any, S any](w http.ResponseWriter, r *http.Request) {
+	sub2[T, S2, S](w, r, Import[T])
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// parseTag reads the crud struct tag, a comma separated list of keys with
+// optional values, e.g. `crud:"search,weight=2"`.
+func parseTag(tag reflect.StructTag) map[string]string {
+
+	settings := map[string]string{}
+
+	for _, option := range strings.Split(tag.Get("crud"), ",") {
+
+		option = strings.TrimSpace(option)
+		if option == "" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(option, "=")
+		settings[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+
+	return settings
+}
+
+func tagHas(tag reflect.StructTag, key string) bool {
+	_, ok := parseTag(tag)[key]
+	return ok
+}
+
+func tagFloat(tag reflect.StructTag, key string, fallback float64) float64 {
+
+	value, err := strconv.ParseFloat(parseTag(tag)[key], 64)
+	if err != nil {
+		return fallback
+	}
+
+	return value
+}
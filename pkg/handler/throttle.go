@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diogomattioli/crud/pkg/data"
+)
+
+// LoginThrottle slows down password guessing on Login. The attempts are
+// counted per user, regardless of case, and per IP before the password is
+// checked, and after Free of them each new one locks the user or IP out for
+// Base, doubled on every further attempt up to Max. Attempts are forgotten
+// Window after the last one and, on a successful login, for the user,
+// while the IP gets the attempt back. ClientIP tells the IP of a request,
+// its remote address by default.
+type LoginThrottle struct {
+	Store    data.AttemptStore
+	Free     int
+	Base     time.Duration
+	Max      time.Duration
+	Window   time.Duration
+	ClientIP func(r *http.Request) string
+}
+
+// DefaultLoginThrottle locks out for a second after 5 failures, up to 15
+// minutes, forgetting them after an hour. Its Store must be set.
+var DefaultLoginThrottle = LoginThrottle{Free: 5, Base: time.Second, Max: 15 * time.Minute, Window: time.Hour}
+
+var throttle *LoginThrottle
+
+// SetLoginThrottle makes Login throttled by _throttle, or not when nil.
+func SetLoginThrottle(_throttle *LoginThrottle) {
+	throttle = _throttle
+}
+
+func remoteIP(r *http.Request) string {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func (t *LoginThrottle) keys(r *http.Request, user string) []string {
+
+	clientIP := t.ClientIP
+	if clientIP == nil {
+		clientIP = remoteIP
+	}
+
+	return []string{"user:" + strings.ToLower(user), "ip:" + clientIP(r)}
+}
+
+// lockout returns for how long the attempt counted as the nth locks out.
+func (t *LoginThrottle) lockout(attempts int) time.Duration {
+
+	if attempts <= t.Free {
+		return 0
+	}
+
+	lockout := time.Duration(float64(t.Base) * math.Pow(2, float64(attempts-t.Free-1)))
+	if lockout > t.Max || lockout <= 0 {
+		lockout = t.Max
+	}
+
+	return lockout
+}
+
+// attempt counts an attempt of the user and IP of r, returning until when
+// either is locked out, in which case it is not counted, or zero.
+func (t *LoginThrottle) attempt(r *http.Request, user string) (time.Time, error) {
+
+	keys := t.keys(r, user)
+
+	for i, key := range keys {
+
+		until, err := t.Store.Attempt(key, t.Window, t.lockout)
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		if !until.IsZero() {
+			for _, counted := range keys[:i] {
+				t.Store.Refund(counted)
+			}
+			return until, nil
+		}
+	}
+
+	return time.Time{}, nil
+}
+
+// succeed forgets the attempts of the user of r and refunds the one of its
+// IP.
+func (t *LoginThrottle) succeed(r *http.Request, user string) error {
+
+	keys := t.keys(r, user)
+
+	err := t.Store.Reset(keys[0])
+	if err != nil {
+		return err
+	}
+
+	return t.Store.Refund(keys[1])
+}
+
+// writeLocked writes a 429 problem telling to retry once until passed.
+func writeLocked(w http.ResponseWriter, until time.Time) {
+
+	seconds := int(math.Ceil(time.Until(until).Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	writeProblem(w, http.StatusTooManyRequests, "too many failed login attempts")
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diogomattioli/crud/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type MockPassword struct {
+	MockAuth
+}
+
+func (a MockPassword) Authenticate(user string, pass string) bool {
+	return pass == "right"
+}
+
+func login(t *testing.T, user string, pass string, addr string) *httptest.ResponseRecorder {
+
+	req, err := http.NewRequest("POST", "/login/", strings.NewReader("user="+user+"&pass="+pass))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = addr
+
+	return serveHTTPAuth(req)
+}
+
+func TestLoginLockout(t *testing.T) {
+
+	SetAuthenticator(&MockPassword{})
+	defer SetAuthenticator(&MockAuth{})
+
+	SetLoginThrottle(&LoginThrottle{Store: store.NewAttempts(0), Free: 2, Base: time.Minute, Max: time.Hour, Window: time.Hour})
+	defer SetLoginThrottle(nil)
+
+	for i := 0; i < 3; i++ {
+		rec := login(t, "a", "wrong", "10.0.0.1:1000")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	rec := login(t, "a", "right", "10.0.0.2:1000")
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
+
+	var body problem
+	json.NewDecoder(rec.Body).Decode(&body)
+
+	assert.Equal(t, "too many failed login attempts", body.Detail)
+
+	rec = login(t, "b", "right", "10.0.0.1:1001")
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	rec = login(t, "b", "right", "10.0.0.2:1000")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestLoginBackoff(t *testing.T) {
+
+	throttle := &LoginThrottle{Free: 1, Base: time.Minute, Max: 3 * time.Minute, Window: time.Hour}
+
+	for i, lockout := range []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute} {
+		assert.Equal(t, lockout, throttle.lockout(i+1), i)
+	}
+}
+
+func TestLoginConcurrent(t *testing.T) {
+
+	SetAuthenticator(&MockPassword{})
+	defer SetAuthenticator(&MockAuth{})
+
+	SetLoginThrottle(&LoginThrottle{Store: store.NewAttempts(0), Free: 2, Base: time.Minute, Max: time.Hour, Window: time.Hour})
+	defer SetLoginThrottle(nil)
+
+	var (
+		wait  sync.WaitGroup
+		mutex sync.Mutex
+		codes = map[int]int{}
+	)
+
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			user := "a"
+			if i%2 == 0 {
+				user = "A"
+			}
+			rec := login(t, user, "wrong", fmt.Sprintf("10.0.0.%d:1000", i))
+			mutex.Lock()
+			codes[rec.Code]++
+			mutex.Unlock()
+		}(i)
+	}
+
+	wait.Wait()
+
+	assert.Equal(t, 3, codes[http.StatusUnauthorized])
+	assert.Equal(t, 7, codes[http.StatusTooManyRequests])
+}
+
+func TestLoginResetOnSuccess(t *testing.T) {
+
+	SetAuthenticator(&MockPassword{})
+	defer SetAuthenticator(&MockAuth{})
+
+	SetLoginThrottle(&LoginThrottle{Store: store.NewAttempts(0), Free: 2, Base: time.Minute, Max: time.Hour, Window: time.Hour})
+	defer SetLoginThrottle(nil)
+
+	assert.Equal(t, http.StatusUnauthorized, login(t, "a", "wrong", "10.0.0.1:1000").Code)
+	assert.Equal(t, http.StatusUnauthorized, login(t, "a", "wrong", "10.0.0.2:1000").Code)
+	assert.Equal(t, http.StatusOK, login(t, "a", "right", "10.0.0.3:1000").Code)
+	assert.Equal(t, http.StatusUnauthorized, login(t, "a", "wrong", "10.0.0.4:1000").Code)
+	assert.Equal(t, http.StatusUnauthorized, login(t, "a", "wrong", "10.0.0.5:1000").Code)
+	assert.Equal(t, http.StatusOK, login(t, "a", "right", "10.0.0.6:1000").Code)
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// TokenExtractor reads the access token of a request, returning an empty
+// string when it carries none.
+type TokenExtractor func(r *http.Request) string
+
+var extractors = []TokenExtractor{HeaderToken("X-Access-Token")}
+
+// SetTokenExtractors sets the extractors tried in order for the token of
+// the requests, the X-Access-Token header only by default.
+func SetTokenExtractors(_extractors ...TokenExtractor) {
+	extractors = _extractors
+}
+
+// requestToken returns the token of r found by the first extractor
+// finding one.
+func requestToken(r *http.Request) string {
+
+	for _, extractor := range extractors {
+		if token := extractor(r); token != "" {
+			return token
+		}
+	}
+
+	return ""
+}
+
+// HeaderToken reads the token of the named header.
+func HeaderToken(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// BearerToken reads the token of the Authorization header with the Bearer
+// scheme.
+func BearerToken() TokenExtractor {
+	return func(r *http.Request) string {
+
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+
+		return strings.TrimSpace(token)
+	}
+}
+
+// QueryToken reads the token of the named query parameter, meant for
+// links, as URLs end up in logs and histories.
+func QueryToken(name string) TokenExtractor {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// CookieToken reads the token of the cookie named by config. Unless the
+// method is safe, the CSRF header must repeat the CSRF cookie for the
+// token to be read, when config names them.
+func CookieToken(config CookieConfig) TokenExtractor {
+	return func(r *http.Request) string {
+
+		cookie, err := r.Cookie(config.Name)
+		if err != nil {
+			return ""
+		}
+
+		if config.CSRFCookie != "" && !safeMethod(r.Method) {
+
+			csrf, err := r.Cookie(config.CSRFCookie)
+			if err != nil || csrf.Value == "" {
+				return ""
+			}
+
+			if subtle.ConstantTimeCompare([]byte(csrf.Value), []byte(r.Header.Get(config.CSRFHeader))) != 1 {
+				return ""
+			}
+		}
+
+		return cookie.Value
+	}
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// CookieConfig is the cookie Login sets the access token in, HttpOnly,
+// along with a CSRF cookie readable by scripts to be repeated in the CSRF
+// header, the double-submit pattern, when CSRFCookie is set.
+type CookieConfig struct {
+	Name       string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   http.SameSite
+	CSRFCookie string
+	CSRFHeader string
+}
+
+// DefaultCookie is a secure, same site lax cookie with CSRF protection.
+var DefaultCookie = CookieConfig{
+	Name:       "access_token",
+	Path:       "/",
+	Secure:     true,
+	SameSite:   http.SameSiteLaxMode,
+	CSRFCookie: "csrf_token",
+	CSRFHeader: "X-CSRF-Token",
+}
+
+var cookieConfig *CookieConfig
+
+// SetCookie makes Login and Refresh set the token cookie of config and
+// Logout clear it, or stops them when config is nil. The cookie is read
+// with the CookieToken extractor.
+func SetCookie(config *CookieConfig) {
+	cookieConfig = config
+}
+
+// setTokenCookies sets the token cookie, and a new CSRF cookie, lasting
+// maxAge seconds or the browser session when zero.
+func setTokenCookies(w http.ResponseWriter, token string, maxAge int) error {
+
+	if cookieConfig == nil {
+		return nil
+	}
+
+	http.SetCookie(w, tokenCookie(cookieConfig.Name, token, maxAge, true))
+
+	if cookieConfig.CSRFCookie == "" {
+		return nil
+	}
+
+	bytes := make([]byte, 32)
+
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, tokenCookie(cookieConfig.CSRFCookie, base64.RawURLEncoding.EncodeToString(bytes), maxAge, false))
+
+	return nil
+}
+
+// clearTokenCookies expires the token and CSRF cookies.
+func clearTokenCookies(w http.ResponseWriter) {
+
+	if cookieConfig == nil {
+		return
+	}
+
+	http.SetCookie(w, tokenCookie(cookieConfig.Name, "", -1, true))
+
+	if cookieConfig.CSRFCookie != "" {
+		http.SetCookie(w, tokenCookie(cookieConfig.CSRFCookie, "", -1, false))
+	}
+}
+
+func tokenCookie(name string, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     cookieConfig.Path,
+		Domain:   cookieConfig.Domain,
+		MaxAge:   maxAge,
+		Secure:   cookieConfig.Secure,
+		HttpOnly: httpOnly,
+		SameSite: cookieConfig.SameSite,
+	}
+}
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBearerToken(t *testing.T) {
+
+	SetAuthenticator(&MockAuth{})
+
+	SetTokenExtractors(BearerToken())
+	defer SetTokenExtractors(HeaderToken("X-Access-Token"))
+
+	req, err := http.NewRequest("GET", "/auth/dummy/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Authorization", "Bearer 123-token")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req.Header.Set("Authorization", "bearer 123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req.Header.Set("Authorization", "Basic 123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req.Header.Del("Authorization")
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestTokenExtractorChain(t *testing.T) {
+
+	SetAuthenticator(&MockAuth{})
+
+	SetTokenExtractors(HeaderToken("X-Access-Token"), BearerToken(), QueryToken("access_token"))
+	defer SetTokenExtractors(HeaderToken("X-Access-Token"))
+
+	req, err := http.NewRequest("GET", "/auth/dummy/?access_token=123-token", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req.Header.Set("Authorization", "Bearer token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req.Header.Set("X-Access-Token", "123-token")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestSessionToken(t *testing.T) {
+
+	SetTokenExtractors(BearerToken())
+	defer SetTokenExtractors(HeaderToken("X-Access-Token"))
+
+	setupDb(0)
+	defer destroyDb()
+
+	req, err := http.NewRequest("POST", "/dummy/", strings.NewReader("{\"title\":\"title\",\"valid\":true}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer abc")
+
+	rec := serveHTTP(req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "{\"code\":1,\"message\":\"Token - abc\"}", rec.Body.String())
+}
+
+func TestLoginCookie(t *testing.T) {
+
+	SetAuthenticator(&MockRefresher{})
+	defer SetAuthenticator(&MockAuth{})
+
+	SetCookie(&DefaultCookie)
+	defer SetCookie(nil)
+
+	req, err := http.NewRequest("POST", "/login/", strings.NewReader("user=a&pass=a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	cookies := rec.Result().Cookies()
+
+	assert.Equal(t, 2, len(cookies))
+
+	assert.Equal(t, "access_token", cookies[0].Name)
+	assert.Equal(t, "a-access", cookies[0].Value)
+	assert.Equal(t, 900, cookies[0].MaxAge)
+	assert.Equal(t, true, cookies[0].HttpOnly)
+	assert.Equal(t, true, cookies[0].Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+
+	assert.Equal(t, "csrf_token", cookies[1].Name)
+	assert.NotEqual(t, "", cookies[1].Value)
+	assert.Equal(t, false, cookies[1].HttpOnly)
+}
+
+func TestCookieToken(t *testing.T) {
+
+	SetAuthenticator(&MockAuth{})
+
+	SetTokenExtractors(CookieToken(DefaultCookie))
+	defer SetTokenExtractors(HeaderToken("X-Access-Token"))
+
+	setupDb(0)
+	defer destroyDb()
+
+	req, err := http.NewRequest("GET", "/auth/dummy/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: "123-token"})
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	req, err = http.NewRequest("POST", "/auth/dummy/", strings.NewReader("{\"title\":\"title\",\"valid\":true}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: "123-token"})
+	req.AddCookie(&http.Cookie{Name: "csrf_token", Value: "csrf"})
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req.Header.Set("X-CSRF-Token", "other")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req.Header.Set("X-CSRF-Token", "csrf")
+
+	rec = serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "{\"code\":1,\"message\":\"Token - 123-token\"}", rec.Body.String())
+}
+
+func TestLogoutCookie(t *testing.T) {
+
+	SetAuthenticator(&MockAuth{})
+
+	SetCookie(&DefaultCookie)
+	defer SetCookie(nil)
+
+	req, err := http.NewRequest("POST", "/logout/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serveHTTPAuth(req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	cookies := rec.Result().Cookies()
+
+	assert.Equal(t, 2, len(cookies))
+	assert.Equal(t, "access_token", cookies[0].Name)
+	assert.Equal(t, "", cookies[0].Value)
+	assert.Equal(t, -1, cookies[0].MaxAge)
+}
@@ -0,0 +1,524 @@
+// Package jwt implements data.Authenticator with signed JSON Web Tokens.
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/diogomattioli/crud/pkg/data"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrAlgorithm = errors.New("unexpected algorithm")
+	ErrExpired   = errors.New("token expired")
+	ErrNotYet    = errors.New("token not valid yet")
+	ErrIssuer    = errors.New("unexpected issuer")
+	ErrAudience  = errors.New("unexpected audience")
+	ErrRevoked   = errors.New("token revoked")
+	ErrTokenUse  = errors.New("unexpected token use")
+	ErrNoStore   = data.ErrNoStore
+	ErrSubject   = errors.New("unexpected subject")
+)
+
+// Audience holds the aud claim, a single string or an array of them.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+func (a Audience) Contains(audience string) bool {
+
+	for _, item := range a {
+		if item == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Claims are the registered claims of the tokens.
+type Claims struct {
+	Subject   string   `json:"sub"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Use       string   `json:"token_use,omitempty"`
+}
+
+var registered = map[string]bool{"sub": true, "iss": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true, "token_use": true}
+
+// useRefresh is the token_use claim of the refresh tokens, access tokens
+// having none.
+const useRefresh = "refresh"
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Authenticator issues and verifies tokens. The first of Keys signs the
+// tokens and every one of them verifies those naming it, by kid, or any
+// without one. Authenticate defers to Check and ClaimsFor adds claims to
+// the access tokens issued, e.g. roles and tenant read back by Identify.
+// Tokens revoked into Revocations are rejected and refresh tokens used
+// once; without it no refresh tokens are issued, as they could not be
+// rotated.
+type Authenticator struct {
+	Keys          []Key
+	Issuer        string
+	Audience      string
+	Expiry        time.Duration
+	RefreshExpiry time.Duration
+	Leeway        time.Duration
+	Check         func(user string, pass string) bool
+	ClaimsFor     func(user string) map[string]any
+	Revocations   data.RevocationStore
+
+	now func() time.Time
+}
+
+var (
+	_ data.Authenticator = (*Authenticator)(nil)
+	_ data.Identifier    = (*Authenticator)(nil)
+	_ data.Refresher     = (*Authenticator)(nil)
+	_ data.Expirer       = (*Authenticator)(nil)
+)
+
+const (
+	defaultExpiry        = 15 * time.Minute
+	defaultRefreshExpiry = 7 * 24 * time.Hour
+)
+
+var encoding = base64.RawURLEncoding
+
+func (a *Authenticator) clock() time.Time {
+
+	if a.now != nil {
+		return a.now()
+	}
+
+	return time.Now()
+}
+
+func (a *Authenticator) Authenticate(user string, pass string) bool {
+	return a.Check != nil && a.Check(user, pass)
+}
+
+// Create issues a token for user, or returns an empty string when it cannot
+// be signed.
+func (a *Authenticator) Create(user string) string {
+
+	token, err := a.Sign(user)
+	if err != nil {
+		return ""
+	}
+
+	return token
+}
+
+func (a *Authenticator) expiry() time.Duration {
+
+	if a.Expiry <= 0 {
+		return defaultExpiry
+	}
+
+	return a.Expiry
+}
+
+// ExpiresIn returns in how long the access tokens expire.
+func (a *Authenticator) ExpiresIn() time.Duration {
+	return a.expiry()
+}
+
+func (a *Authenticator) refreshExpiry() time.Duration {
+
+	if a.RefreshExpiry <= 0 {
+		return defaultRefreshExpiry
+	}
+
+	return a.RefreshExpiry
+}
+
+// Sign issues an access token for user.
+func (a *Authenticator) Sign(user string) (string, error) {
+	return a.sign(user, "", a.expiry())
+}
+
+func (a *Authenticator) sign(user string, use string, expiry time.Duration) (string, error) {
+
+	if len(a.Keys) == 0 {
+		return "", errors.New("no signing key")
+	}
+
+	key := a.Keys[0]
+
+	id := make([]byte, 16)
+
+	_, err := rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	now := a.clock()
+
+	claims := Claims{
+		Subject:   user,
+		Issuer:    a.Issuer,
+		ExpiresAt: now.Add(expiry).Unix(),
+		IssuedAt:  now.Unix(),
+		ID:        encoding.EncodeToString(id),
+		Use:       use,
+	}
+
+	if a.Audience != "" {
+		claims.Audience = Audience{a.Audience}
+	}
+
+	head, err := json.Marshal(header{Alg: key.Algorithm(), Typ: "JWT", Kid: key.ID()})
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	if a.ClaimsFor != nil && use == "" {
+
+		all := map[string]any{}
+		for key, value := range a.ClaimsFor(user) {
+			if !registered[key] {
+				all[key] = value
+			}
+		}
+
+		err = json.Unmarshal(body, &all)
+		if err != nil {
+			return "", err
+		}
+
+		body, err = json.Marshal(all)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	unsigned := encoding.EncodeToString(head) + "." + encoding.EncodeToString(body)
+
+	signature, err := key.Sign([]byte(unsigned))
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + encoding.EncodeToString(signature), nil
+}
+
+// CreatePair issues an access token for user along with a refresh token,
+// failing with ErrNoStore when there is no store to rotate the latter.
+func (a *Authenticator) CreatePair(user string) (data.TokenPair, error) {
+
+	if a.Revocations == nil {
+		return data.TokenPair{}, ErrNoStore
+	}
+
+	access, err := a.Sign(user)
+	if err != nil {
+		return data.TokenPair{}, err
+	}
+
+	refresh, err := a.sign(user, useRefresh, a.refreshExpiry())
+	if err != nil {
+		return data.TokenPair{}, err
+	}
+
+	return data.TokenPair{AccessToken: access, RefreshToken: refresh, ExpiresIn: int64(a.expiry() / time.Second)}, nil
+}
+
+// Refresh issues a new pair for the subject of refreshToken, revoking it.
+func (a *Authenticator) Refresh(refreshToken string) (data.TokenPair, error) {
+
+	if a.Revocations == nil {
+		return data.TokenPair{}, ErrNoStore
+	}
+
+	claims, err := a.Parse(refreshToken)
+	if err != nil {
+		return data.TokenPair{}, err
+	}
+
+	if claims.Use != useRefresh {
+		return data.TokenPair{}, ErrTokenUse
+	}
+
+	already, err := a.revoke(claims)
+	if err != nil {
+		return data.TokenPair{}, err
+	}
+
+	// a concurrent refresh used it first
+	if already {
+		return data.TokenPair{}, ErrRevoked
+	}
+
+	return a.CreatePair(claims.Subject)
+}
+
+// Revoke makes token, an access or refresh token, unusable until it
+// expires.
+func (a *Authenticator) Revoke(token string) error {
+
+	if a.Revocations == nil {
+		return ErrNoStore
+	}
+
+	claims, err := a.Parse(token)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.revoke(claims)
+
+	return err
+}
+
+// RevokePair revokes accessToken and refreshToken, when not empty, which
+// must have been issued to the same subject; neither is revoked otherwise.
+func (a *Authenticator) RevokePair(accessToken string, refreshToken string) error {
+
+	if a.Revocations == nil {
+		return ErrNoStore
+	}
+
+	access, err := a.parseAccess(accessToken)
+	if err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		_, err = a.revoke(access)
+		return err
+	}
+
+	refresh, err := a.Parse(refreshToken)
+	if err != nil {
+		return err
+	}
+
+	if refresh.Use != useRefresh {
+		return ErrTokenUse
+	}
+
+	if refresh.Subject != access.Subject {
+		return ErrSubject
+	}
+
+	_, err = a.revoke(access)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.revoke(refresh)
+
+	return err
+}
+
+func (a *Authenticator) revoke(claims *Claims) (bool, error) {
+
+	if claims.ID == "" {
+		return false, ErrMalformed
+	}
+
+	return a.Revocations.Revoke(claims.ID, time.Unix(claims.ExpiresAt, 0).Add(a.Leeway))
+}
+
+// Use tells whether token is a valid access token.
+func (a *Authenticator) Use(token string) bool {
+	_, err := a.parseAccess(token)
+	return err == nil
+}
+
+func (a *Authenticator) parseAccess(token string) (*Claims, error) {
+
+	claims, err := a.Parse(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Use != "" {
+		return nil, ErrTokenUse
+	}
+
+	return claims, nil
+}
+
+// Parse verifies the signature and claims of token, returning its claims.
+// The algorithm of the token must be the one of the verifying key.
+func (a *Authenticator) Parse(token string) (*Claims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var head header
+
+	err := decodePart(parts[0], &head)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	unsigned := []byte(parts[0] + "." + parts[1])
+
+	verified := false
+
+	for _, key := range a.Keys {
+
+		if head.Kid != "" && key.ID() != head.Kid {
+			continue
+		}
+
+		if key.Algorithm() != head.Alg {
+			continue
+		}
+
+		if key.Verify(unsigned, signature) == nil {
+			verified = true
+			break
+		}
+	}
+
+	if !verified {
+		if !a.knows(head.Alg) {
+			return nil, ErrAlgorithm
+		}
+		return nil, ErrSignature
+	}
+
+	var claims Claims
+
+	err = decodePart(parts[1], &claims)
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.clock()
+
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(a.Leeway)) {
+		return nil, ErrExpired
+	}
+
+	if claims.NotBefore != 0 && now.Add(a.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrNotYet
+	}
+
+	if a.Issuer != "" && claims.Issuer != a.Issuer {
+		return nil, ErrIssuer
+	}
+
+	if a.Audience != "" && !claims.Audience.Contains(a.Audience) {
+		return nil, ErrAudience
+	}
+
+	if a.Revocations != nil && claims.ID != "" {
+
+		revoked, err := a.Revocations.Revoked(claims.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if revoked {
+			return nil, ErrRevoked
+		}
+	}
+
+	return &claims, nil
+}
+
+// Identify verifies the access token, returning the identity of its
+// subject with the roles and tenant of its roles and tenant claims.
+func (a *Authenticator) Identify(token string) (*data.Identity, bool) {
+
+	claims, err := a.parseAccess(token)
+	if err != nil {
+		return nil, false
+	}
+
+	all := map[string]any{}
+
+	// already decoded once by Parse
+	_ = decodePart(strings.Split(token, ".")[1], &all)
+
+	identity := &data.Identity{UserID: claims.Subject, Claims: all}
+
+	if roles, ok := all["roles"].([]any); ok {
+		for _, role := range roles {
+			if role, ok := role.(string); ok {
+				identity.Roles = append(identity.Roles, role)
+			}
+		}
+	}
+
+	if tenant, ok := all["tenant"].(string); ok {
+		identity.Tenant = tenant
+	}
+
+	return identity, true
+}
+
+func (a *Authenticator) knows(alg string) bool {
+
+	for _, key := range a.Keys {
+		if key.Algorithm() == alg {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodePart(part string, v any) error {
+
+	bytes, err := encoding.DecodeString(part)
+	if err != nil {
+		return ErrMalformed
+	}
+
+	if json.Unmarshal(bytes, v) != nil {
+		return ErrMalformed
+	}
+
+	return nil
+}
@@ -0,0 +1,338 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/diogomattioli/crud/pkg/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHS256(t *testing.T) {
+
+	a := &Authenticator{
+		Keys:     []Key{HS256("k1", []byte("secret"))},
+		Issuer:   "crud",
+		Audience: "api",
+		Check: func(user string, pass string) bool {
+			return user == "user" && pass == "pass"
+		},
+	}
+
+	assert.Equal(t, true, a.Authenticate("user", "pass"))
+	assert.Equal(t, false, a.Authenticate("user", "wrong"))
+
+	token := a.Create("user")
+	assert.NotEqual(t, "", token)
+	assert.Equal(t, true, a.Use(token))
+
+	claims, err := a.Parse(token)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "user", claims.Subject)
+	assert.Equal(t, "crud", claims.Issuer)
+	assert.Equal(t, Audience{"api"}, claims.Audience)
+
+	parts := strings.Split(token, ".")
+	tampered := parts[0] + "." + encoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999}`)) + "." + parts[2]
+
+	_, err = a.Parse(tampered)
+	assert.Equal(t, ErrSignature, err)
+
+	other := &Authenticator{Keys: []Key{HS256("k1", []byte("other"))}}
+	assert.Equal(t, false, other.Use(token))
+}
+
+func TestClaims(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	a := &Authenticator{
+		Keys:     []Key{HS256("", []byte("secret"))},
+		Issuer:   "crud",
+		Audience: "api",
+		Expiry:   time.Hour,
+		Leeway:   time.Minute,
+		now:      func() time.Time { return now },
+	}
+
+	token := a.Create("user")
+
+	a.now = func() time.Time { return now.Add(time.Hour + 30*time.Second) }
+	assert.Equal(t, true, a.Use(token))
+
+	a.now = func() time.Time { return now.Add(time.Hour + 2*time.Minute) }
+	_, err := a.Parse(token)
+	assert.Equal(t, ErrExpired, err)
+
+	a.now = func() time.Time { return now }
+
+	a.Issuer = "other"
+	_, err = a.Parse(token)
+	assert.Equal(t, ErrIssuer, err)
+
+	a.Issuer = "crud"
+	a.Audience = "other"
+	_, err = a.Parse(token)
+	assert.Equal(t, ErrAudience, err)
+
+	_, err = a.Parse("a.b")
+	assert.Equal(t, ErrMalformed, err)
+
+	unsigned := encoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + encoding.EncodeToString([]byte(`{"sub":"user","exp":9999999999}`)) + "."
+	_, err = a.Parse(unsigned)
+	assert.Equal(t, ErrAlgorithm, err)
+}
+
+func writePEM(t *testing.T, name string, kind string, der []byte) string {
+
+	path := filepath.Join(t.TempDir(), name)
+
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestRS256Files(t *testing.T) {
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signing, err := LoadKey("rsa", "RS256", writePEM(t, "private.pem", "PRIVATE KEY", der))
+	assert.Equal(t, nil, err)
+
+	der, err = x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifying, err := LoadKey("rsa", "RS256", writePEM(t, "public.pem", "PUBLIC KEY", der))
+	assert.Equal(t, nil, err)
+
+	_, err = LoadKey("rsa", "EdDSA", writePEM(t, "public.pem", "PUBLIC KEY", der))
+	assert.NotEqual(t, nil, err)
+
+	token := (&Authenticator{Keys: []Key{signing}}).Create("user")
+
+	verifier := &Authenticator{Keys: []Key{verifying}}
+	assert.Equal(t, true, verifier.Use(token))
+	assert.Equal(t, "", verifier.Create("user"))
+
+	// a token signed with the public key as an HMAC secret is refused
+	confused := &Authenticator{Keys: []Key{HS256("rsa", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))}}
+	assert.Equal(t, false, verifier.Use(confused.Create("user")))
+}
+
+func TestEdDSAJWKS(t *testing.T) {
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := fmt.Sprintf(`{"keys":[{"kty":"OKP","crv":"Ed25519","kid":"other","x":"%s"},{"kty":"OKP","crv":"Ed25519","kid":"ed","x":"%s"},{"kty":"oct","kid":"hs","k":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(other),
+		base64.RawURLEncoding.EncodeToString(public),
+		base64.RawURLEncoding.EncodeToString([]byte("secret")))
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+
+	err = os.WriteFile(path, []byte(document), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadJWKS(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, len(keys))
+
+	verifier := &Authenticator{Keys: keys}
+
+	assert.Equal(t, true, verifier.Use((&Authenticator{Keys: []Key{EdDSA("ed", private, nil)}}).Create("user")))
+	assert.Equal(t, true, verifier.Use((&Authenticator{Keys: []Key{HS256("hs", []byte("secret"))}}).Create("user")))
+	assert.Equal(t, false, verifier.Use((&Authenticator{Keys: []Key{EdDSA("other", private, nil)}}).Create("user")))
+}
+
+func TestIdentify(t *testing.T) {
+
+	a := &Authenticator{
+		Keys:   []Key{HS256("", []byte("secret"))},
+		Issuer: "crud",
+		ClaimsFor: func(user string) map[string]any {
+			return map[string]any{"roles": []string{"admin", "editor"}, "tenant": "acme", "email": user + "@acme.com", "sub": "admin", "iss": "other"}
+		},
+	}
+
+	identity, ok := a.Identify(a.Create("user"))
+
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "user", identity.UserID)
+	assert.Equal(t, []string{"admin", "editor"}, identity.Roles)
+	assert.Equal(t, "acme", identity.Tenant)
+	assert.Equal(t, "user@acme.com", identity.Claims["email"])
+	assert.Equal(t, "crud", identity.Claims["iss"])
+	assert.Equal(t, true, identity.HasRole("editor"))
+	assert.Equal(t, false, identity.HasRole("owner"))
+
+	_, ok = a.Identify("a.b.c")
+	assert.Equal(t, false, ok)
+}
+
+func TestRefresh(t *testing.T) {
+
+	now := time.Now().Truncate(time.Second)
+
+	revocations := store.NewRevocations(0)
+
+	a := &Authenticator{
+		Keys:          []Key{HS256("", []byte("secret"))},
+		Expiry:        time.Minute,
+		RefreshExpiry: time.Hour,
+		Revocations:   revocations,
+		ClaimsFor: func(user string) map[string]any {
+			return map[string]any{"roles": []string{"admin"}}
+		},
+		now: func() time.Time { return now },
+	}
+
+	pair, err := a.CreatePair("user")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(60), pair.ExpiresIn)
+	assert.Equal(t, time.Minute, a.ExpiresIn())
+
+	assert.Equal(t, true, a.Use(pair.AccessToken))
+	assert.Equal(t, false, a.Use(pair.RefreshToken))
+
+	_, ok := a.Identify(pair.RefreshToken)
+	assert.Equal(t, false, ok)
+
+	claims, err := a.Parse(pair.RefreshToken)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "refresh", claims.Use)
+	assert.Equal(t, now.Add(time.Hour).Unix(), claims.ExpiresAt)
+
+	_, err = a.Refresh(pair.AccessToken)
+	assert.Equal(t, ErrTokenUse, err)
+
+	a.now = func() time.Time { return now.Add(30 * time.Minute) }
+
+	_, err = a.Parse(pair.AccessToken)
+	assert.Equal(t, ErrExpired, err)
+
+	renewed, err := a.Refresh(pair.RefreshToken)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, a.Use(renewed.AccessToken))
+
+	identity, ok := a.Identify(renewed.AccessToken)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []string{"admin"}, identity.Roles)
+
+	_, err = a.Refresh(pair.RefreshToken)
+	assert.Equal(t, ErrRevoked, err)
+}
+
+func TestRefreshConcurrent(t *testing.T) {
+
+	a := &Authenticator{Keys: []Key{HS256("", []byte("secret"))}, Revocations: store.NewRevocations(0)}
+
+	pair, err := a.CreatePair("user")
+	assert.Equal(t, nil, err)
+
+	var (
+		wait    sync.WaitGroup
+		mutex   sync.Mutex
+		renewed int
+	)
+
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			if _, err := a.Refresh(pair.RefreshToken); err == nil {
+				mutex.Lock()
+				renewed++
+				mutex.Unlock()
+			}
+		}()
+	}
+
+	wait.Wait()
+
+	assert.Equal(t, 1, renewed)
+}
+
+func TestRevoke(t *testing.T) {
+
+	a := &Authenticator{Keys: []Key{HS256("", []byte("secret"))}}
+
+	_, err := a.CreatePair("user")
+	assert.Equal(t, ErrNoStore, err)
+
+	assert.Equal(t, ErrNoStore, a.Revoke(a.Create("user")))
+
+	revocations := store.NewRevocations(0)
+	a.Revocations = revocations
+
+	pair, err := a.CreatePair("user")
+	assert.Equal(t, nil, err)
+
+	a.Revocations = nil
+
+	_, err = a.Refresh(pair.RefreshToken)
+	assert.Equal(t, ErrNoStore, err)
+
+	a.Revocations = revocations
+
+	assert.Equal(t, nil, a.Revoke(pair.AccessToken))
+	assert.Equal(t, false, a.Use(pair.AccessToken))
+	assert.Equal(t, true, a.Use(a.Create("user")))
+
+	assert.Equal(t, nil, a.Revoke(pair.RefreshToken))
+
+	_, err = a.Refresh(pair.RefreshToken)
+	assert.Equal(t, ErrRevoked, err)
+
+	assert.Equal(t, ErrMalformed, a.Revoke("a.b.c"))
+
+	other, err := a.CreatePair("other")
+	assert.Equal(t, nil, err)
+
+	pair, err = a.CreatePair("user")
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, ErrSubject, a.RevokePair(other.AccessToken, pair.RefreshToken))
+	assert.Equal(t, ErrTokenUse, a.RevokePair(other.AccessToken, other.AccessToken))
+	assert.Equal(t, true, a.Use(other.AccessToken))
+
+	assert.Equal(t, nil, a.RevokePair(other.AccessToken, other.RefreshToken))
+	assert.Equal(t, false, a.Use(other.AccessToken))
+
+	_, err = a.Refresh(other.RefreshToken)
+	assert.Equal(t, ErrRevoked, err)
+	assert.Equal(t, 4, revocations.Len())
+}
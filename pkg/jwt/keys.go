@@ -0,0 +1,294 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+var (
+	ErrSignature  = errors.New("invalid signature")
+	ErrVerifyOnly = errors.New("key cannot sign")
+)
+
+// Key signs and verifies tokens with a single algorithm. Keys built from
+// public keys only verify.
+type Key interface {
+	ID() string
+	Algorithm() string
+	Sign(data []byte) ([]byte, error)
+	Verify(data []byte, signature []byte) error
+}
+
+type hmacKey struct {
+	id     string
+	secret []byte
+}
+
+// HS256 returns a key signing with HMAC SHA-256 and secret.
+func HS256(id string, secret []byte) Key {
+	return &hmacKey{id, secret}
+}
+
+func (k *hmacKey) ID() string {
+	return k.id
+}
+
+func (k *hmacKey) Algorithm() string {
+	return "HS256"
+}
+
+func (k *hmacKey) Sign(data []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (k *hmacKey) Verify(data []byte, signature []byte) error {
+
+	expected, _ := k.Sign(data)
+	if !hmac.Equal(expected, signature) {
+		return ErrSignature
+	}
+
+	return nil
+}
+
+type rsaKey struct {
+	id      string
+	private *rsa.PrivateKey
+	public  *rsa.PublicKey
+}
+
+// RS256 returns a key signing with RSA PKCS #1 v1.5 and SHA-256. A nil
+// private key only verifies.
+func RS256(id string, private *rsa.PrivateKey, public *rsa.PublicKey) Key {
+
+	if public == nil && private != nil {
+		public = &private.PublicKey
+	}
+
+	return &rsaKey{id, private, public}
+}
+
+func (k *rsaKey) ID() string {
+	return k.id
+}
+
+func (k *rsaKey) Algorithm() string {
+	return "RS256"
+}
+
+func (k *rsaKey) Sign(data []byte) ([]byte, error) {
+
+	if k.private == nil {
+		return nil, ErrVerifyOnly
+	}
+
+	hash := sha256.Sum256(data)
+
+	return rsa.SignPKCS1v15(rand.Reader, k.private, crypto.SHA256, hash[:])
+}
+
+func (k *rsaKey) Verify(data []byte, signature []byte) error {
+
+	hash := sha256.Sum256(data)
+
+	if rsa.VerifyPKCS1v15(k.public, crypto.SHA256, hash[:], signature) != nil {
+		return ErrSignature
+	}
+
+	return nil
+}
+
+type edKey struct {
+	id      string
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// EdDSA returns a key signing with Ed25519. A nil private key only
+// verifies.
+func EdDSA(id string, private ed25519.PrivateKey, public ed25519.PublicKey) Key {
+
+	if public == nil && private != nil {
+		public = private.Public().(ed25519.PublicKey)
+	}
+
+	return &edKey{id, private, public}
+}
+
+func (k *edKey) ID() string {
+	return k.id
+}
+
+func (k *edKey) Algorithm() string {
+	return "EdDSA"
+}
+
+func (k *edKey) Sign(data []byte) ([]byte, error) {
+
+	if k.private == nil {
+		return nil, ErrVerifyOnly
+	}
+
+	return ed25519.Sign(k.private, data), nil
+}
+
+func (k *edKey) Verify(data []byte, signature []byte) error {
+
+	if !ed25519.Verify(k.public, data, signature) {
+		return ErrSignature
+	}
+
+	return nil
+}
+
+// LoadKey reads the key of alg from the file at path, the secret itself for
+// HS256 and a PEM encoded private or public key for RS256 and EdDSA.
+func LoadKey(id string, alg string, path string) (Key, error) {
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if alg == "HS256" {
+		return HS256(id, bytes), nil
+	}
+
+	block, _ := pem.Decode(bytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	var parsed any
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %s", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if alg == "RS256" {
+			return RS256(id, key, nil), nil
+		}
+	case *rsa.PublicKey:
+		if alg == "RS256" {
+			return RS256(id, nil, key), nil
+		}
+	case ed25519.PrivateKey:
+		if alg == "EdDSA" {
+			return EdDSA(id, key, nil), nil
+		}
+	case ed25519.PublicKey:
+		if alg == "EdDSA" {
+			return EdDSA(id, nil, key), nil
+		}
+	}
+
+	return nil, fmt.Errorf("key in %s does not match %s", path, alg)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	K   string `json:"k"`
+}
+
+// LoadJWKS reads the keys of the JWKS document at path, RSA and Ed25519
+// public keys verifying only and symmetric ones for HS256.
+func LoadJWKS(path string) ([]Key, error) {
+
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	err = json.Unmarshal(bytes, &set)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+
+	for _, key := range set.Keys {
+
+		switch {
+		case key.Kty == "RSA":
+
+			n, err := base64.RawURLEncoding.DecodeString(key.N)
+			if err != nil {
+				return nil, err
+			}
+
+			e, err := base64.RawURLEncoding.DecodeString(key.E)
+			if err != nil {
+				return nil, err
+			}
+
+			public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+
+			keys = append(keys, RS256(key.Kid, nil, public))
+
+		case key.Kty == "OKP" && key.Crv == "Ed25519":
+
+			x, err := base64.RawURLEncoding.DecodeString(key.X)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid Ed25519 key %s", key.Kid)
+			}
+
+			keys = append(keys, EdDSA(key.Kid, nil, ed25519.PublicKey(x)))
+
+		case key.Kty == "oct":
+
+			k, err := base64.RawURLEncoding.DecodeString(key.K)
+			if err != nil {
+				return nil, err
+			}
+
+			keys = append(keys, HS256(key.Kid, k))
+
+		default:
+			return nil, fmt.Errorf("unsupported key type %s", key.Kty)
+		}
+	}
+
+	return keys, nil
+}
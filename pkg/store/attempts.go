@@ -0,0 +1,170 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diogomattioli/crud/pkg/data"
+)
+
+type attempt struct {
+	attempts    int
+	expiresAt   time.Time
+	lockedUntil time.Time
+}
+
+// Attempts is an in-memory data.AttemptStore. The keys are forgotten once
+// both their attempts and lockout expired, on lookup and by a cleanup every
+// interval when one is given.
+type Attempts struct {
+	mutex    sync.Mutex
+	attempts map[string]*attempt
+	done     chan struct{}
+	closing  sync.Once
+
+	now func() time.Time
+}
+
+var _ data.AttemptStore = (*Attempts)(nil)
+
+// NewAttempts returns an empty store, cleaning up the expired keys every
+// interval until closed when interval is positive.
+func NewAttempts(interval time.Duration) *Attempts {
+
+	s := &Attempts{attempts: map[string]*attempt{}, done: make(chan struct{}), now: time.Now}
+
+	if interval > 0 {
+		go s.run(interval)
+	}
+
+	return s
+}
+
+func (s *Attempts) run(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Cleanup()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (a *attempt) expired(now time.Time) bool {
+	return !now.Before(a.expiresAt) && !now.Before(a.lockedUntil)
+}
+
+// get returns the attempts of key, forgetting their count once expired.
+// The mutex must be held.
+func (s *Attempts) get(key string) *attempt {
+
+	now := s.now()
+
+	item, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+
+	if item.expired(now) {
+		delete(s.attempts, key)
+		return nil
+	}
+
+	if !now.Before(item.expiresAt) {
+		item.attempts = 0
+	}
+
+	return item
+}
+
+func (s *Attempts) Attempt(key string, ttl time.Duration, lockout func(attempts int) time.Duration) (time.Time, error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+
+	item := s.get(key)
+	if item == nil {
+		item = &attempt{}
+		s.attempts[key] = item
+	}
+
+	if now.Before(item.lockedUntil) {
+		return item.lockedUntil, nil
+	}
+
+	item.attempts++
+	item.expiresAt = now.Add(ttl)
+
+	if duration := lockout(item.attempts); duration > 0 {
+		item.lockedUntil = now.Add(duration)
+	}
+
+	return time.Time{}, nil
+}
+
+func (s *Attempts) Refund(key string) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	item := s.get(key)
+	if item == nil {
+		return nil
+	}
+
+	if item.attempts > 0 {
+		item.attempts--
+	}
+
+	item.lockedUntil = time.Time{}
+
+	return nil
+}
+
+func (s *Attempts) Reset(key string) error {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+// Cleanup forgets the expired keys.
+func (s *Attempts) Cleanup() {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+
+	for key, item := range s.attempts {
+		if item.expired(now) {
+			delete(s.attempts, key)
+		}
+	}
+}
+
+// Len returns the number of keys kept.
+func (s *Attempts) Len() int {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.attempts)
+}
+
+// Close stops the cleanup.
+func (s *Attempts) Close() {
+	s.closing.Do(func() {
+		close(s.done)
+	})
+}
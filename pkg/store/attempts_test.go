@@ -0,0 +1,69 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAttempts(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := NewAttempts(0)
+	s.now = func() time.Time { return now }
+
+	var counted []int
+
+	lockout := func(attempts int) time.Duration {
+		counted = append(counted, attempts)
+		if attempts > 2 {
+			return time.Hour
+		}
+		return 0
+	}
+
+	for i := 0; i < 3; i++ {
+		until, err := s.Attempt("a", time.Minute, lockout)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, true, until.IsZero())
+	}
+
+	until, _ := s.Attempt("a", time.Minute, lockout)
+	assert.Equal(t, now.Add(time.Hour), until)
+	assert.Equal(t, []int{1, 2, 3}, counted)
+
+	until, _ = s.Attempt("b", time.Minute, lockout)
+	assert.Equal(t, true, until.IsZero())
+
+	s.Refund("a")
+
+	until, _ = s.Attempt("a", time.Minute, lockout)
+	assert.Equal(t, true, until.IsZero())
+	assert.Equal(t, []int{1, 2, 3, 1, 3}, counted)
+
+	s.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+	until, _ = s.Attempt("a", time.Minute, lockout)
+	assert.Equal(t, now.Add(time.Hour), until)
+
+	s.Cleanup()
+	assert.Equal(t, 1, s.Len())
+
+	s.Reset("a")
+
+	until, _ = s.Attempt("a", time.Minute, lockout)
+	assert.Equal(t, true, until.IsZero())
+	assert.Equal(t, 1, counted[len(counted)-1])
+}
+
+func TestAttemptsCleanup(t *testing.T) {
+
+	s := NewAttempts(time.Millisecond)
+	defer s.Close()
+
+	s.Attempt("a", -time.Second, func(int) time.Duration { return 0 })
+
+	assert.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+}
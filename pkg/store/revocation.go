@@ -0,0 +1,110 @@
+// Package store holds in-memory implementations of the stores of the data
+// package, suited to a single instance and to tests.
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/diogomattioli/crud/pkg/data"
+)
+
+// Revocations is an in-memory data.RevocationStore. The IDs are forgotten
+// once expired, on lookup and by a cleanup every interval when one is given.
+type Revocations struct {
+	mutex   sync.Mutex
+	revoked map[string]time.Time
+	done    chan struct{}
+	closing sync.Once
+
+	now func() time.Time
+}
+
+var _ data.RevocationStore = (*Revocations)(nil)
+
+// NewRevocations returns an empty store, cleaning up the expired IDs every
+// interval until closed when interval is positive.
+func NewRevocations(interval time.Duration) *Revocations {
+
+	s := &Revocations{revoked: map[string]time.Time{}, done: make(chan struct{}), now: time.Now}
+
+	if interval > 0 {
+		go s.run(interval)
+	}
+
+	return s
+}
+
+func (s *Revocations) run(interval time.Duration) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Cleanup()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Revocations) Revoke(id string, expiresAt time.Time) (bool, error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.revoked[id]; ok && s.now().Before(old) {
+		return true, nil
+	}
+
+	s.revoked[id] = expiresAt
+
+	return false, nil
+}
+
+func (s *Revocations) Revoked(id string) (bool, error) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	expiresAt, ok := s.revoked[id]
+	if ok && !s.now().Before(expiresAt) {
+		delete(s.revoked, id)
+		return false, nil
+	}
+
+	return ok, nil
+}
+
+// Cleanup forgets the expired IDs.
+func (s *Revocations) Cleanup() {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+
+	for id, expiresAt := range s.revoked {
+		if !now.Before(expiresAt) {
+			delete(s.revoked, id)
+		}
+	}
+}
+
+// Len returns the number of IDs kept.
+func (s *Revocations) Len() int {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return len(s.revoked)
+}
+
+// Close stops the cleanup.
+func (s *Revocations) Close() {
+	s.closing.Do(func() {
+		close(s.done)
+	})
+}
@@ -0,0 +1,61 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevocations(t *testing.T) {
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s := NewRevocations(0)
+	s.now = func() time.Time { return now }
+
+	already, err := s.Revoke("a", now.Add(time.Minute))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, already)
+
+	already, _ = s.Revoke("a", now.Add(time.Minute))
+	assert.Equal(t, true, already)
+
+	s.Revoke("b", now.Add(time.Hour))
+
+	revoked, err := s.Revoked("a")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, revoked)
+
+	revoked, _ = s.Revoked("c")
+	assert.Equal(t, false, revoked)
+
+	s.now = func() time.Time { return now.Add(time.Minute) }
+
+	revoked, _ = s.Revoked("a")
+	assert.Equal(t, false, revoked)
+	assert.Equal(t, 1, s.Len())
+
+	already, _ = s.Revoke("a", now.Add(time.Hour))
+	assert.Equal(t, false, already)
+
+	s.Revoke("c", now.Add(30*time.Second))
+	s.Cleanup()
+
+	assert.Equal(t, 2, s.Len())
+
+	revoked, _ = s.Revoked("b")
+	assert.Equal(t, true, revoked)
+}
+
+func TestRevocationsCleanup(t *testing.T) {
+
+	s := NewRevocations(time.Millisecond)
+	defer s.Close()
+
+	s.Revoke("a", time.Now().Add(-time.Second))
+
+	assert.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+
+	s.Close()
+}
@@ -0,0 +1,150 @@
+package users
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrUnknownHash = errors.New("unknown hash format")
+
+// Hasher hashes the passwords into a self describing string, telling the
+// hashes of other algorithms or parameters apart to have them replaced.
+type Hasher interface {
+	Hash(password string) (string, error)
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2id hashes with Argon2id into the PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=1,p=4$salt$key.
+type Argon2id struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// DefaultArgon2id holds the parameters recommended by RFC 9106 for
+// memory constrained environments.
+var DefaultArgon2id = Argon2id{Time: 3, Memory: 64 * 1024, Threads: 4, KeyLen: 32, SaltLen: 16}
+
+var encoding = base64.RawStdEncoding
+
+func (h Argon2id) Hash(password string) (string, error) {
+
+	salt := make([]byte, h.SaltLen)
+
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads, encoding.EncodeToString(salt), encoding.EncodeToString(key)), nil
+}
+
+func (h Argon2id) NeedsRehash(encoded string) bool {
+
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+
+	return params.Time != h.Time || params.Memory != h.Memory || params.Threads != h.Threads || uint32(len(key)) != h.KeyLen || uint32(len(salt)) != h.SaltLen
+}
+
+func decodeArgon2id(encoded string) (Argon2id, []byte, []byte, error) {
+
+	var params Argon2id
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	salt, err := encoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	key, err := encoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	return params, salt, key, nil
+}
+
+// Bcrypt hashes with bcrypt at Cost.
+type Bcrypt struct {
+	Cost int
+}
+
+func (h Bcrypt) Hash(password string) (string, error) {
+
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes), nil
+}
+
+func (h Bcrypt) NeedsRehash(encoded string) bool {
+
+	cost, err := bcrypt.Cost([]byte(encoded))
+	if err != nil {
+		return true
+	}
+
+	return cost != h.Cost
+}
+
+// Verify tells whether password matches encoded, a hash of any of the
+// supported algorithms whatever the current hasher.
+func Verify(password string, encoded string) (bool, error) {
+
+	if strings.HasPrefix(encoded, "$argon2id$") {
+
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+
+		computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+
+		return subtle.ConstantTimeCompare(key, computed) == 1, nil
+	}
+
+	if strings.HasPrefix(encoded, "$2") {
+
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+
+		return err == nil, err
+	}
+
+	return false, ErrUnknownHash
+}
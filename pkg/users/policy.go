@@ -0,0 +1,64 @@
+package users
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/diogomattioli/crud/pkg/data"
+)
+
+// PasswordPolicy is what the passwords are required to be, a maximum of
+// zero meaning no maximum.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	Upper     bool
+	Lower     bool
+	Digit     bool
+	Symbol    bool
+}
+
+// DefaultPolicy requires at least 12 characters, as length matters more
+// than composition, and at most 128 to bound the hashing work.
+var DefaultPolicy = PasswordPolicy{MinLength: 12, MaxLength: 128}
+
+// Check returns a validation error of the password field naming every
+// requirement password misses.
+func (p PasswordPolicy) Check(password string) error {
+
+	var missing []string
+
+	length := len([]rune(password))
+
+	if length < p.MinLength {
+		missing = append(missing, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		missing = append(missing, fmt.Sprintf("at most %d characters", p.MaxLength))
+	}
+
+	classes := []struct {
+		required bool
+		name     string
+		is       func(rune) bool
+	}{
+		{p.Upper, "an uppercase letter", unicode.IsUpper},
+		{p.Lower, "a lowercase letter", unicode.IsLower},
+		{p.Digit, "a digit", unicode.IsDigit},
+		{p.Symbol, "a symbol", func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) }},
+	}
+
+	for _, class := range classes {
+		if class.required && strings.IndexFunc(password, class.is) < 0 {
+			missing = append(missing, class.name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return data.FieldValidationErrorNew("password", data.CodeWeakPassword, "Password requires "+strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,287 @@
+// Package users keeps the users in the gorm database of the handlers, with
+// their passwords hashed, and authenticates them for the jwt package.
+package users
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"github.com/diogomattioli/crud/pkg/handler"
+	"github.com/diogomattioli/crud/pkg/jwt"
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// User is a user able to log in. Password is only ever written, being
+// hashed into PasswordHash on save and never returned. CurrentPassword is
+// required along with a new Password unless given by an admin.
+type User struct {
+	ID              int       `json:"id_user" gorm:"primaryKey"`
+	Username        string    `json:"username" gorm:"uniqueIndex"`
+	Password        string    `json:"password,omitempty" gorm:"-"`
+	CurrentPassword string    `json:"current_password,omitempty" gorm:"-"`
+	PasswordHash    string    `json:"-" crud:"nosearch"`
+	Roles           []string  `json:"roles" gorm:"serializer:json"`
+	Tenant          string    `json:"tenant"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+var db *gorm.DB
+
+var hasher Hasher = DefaultArgon2id
+
+var policy = DefaultPolicy
+
+func SetDatabase(_db *gorm.DB) {
+	db = _db
+}
+
+func SetHasher(_hasher Hasher) {
+	hasher = _hasher
+}
+
+func SetPasswordPolicy(_policy PasswordPolicy) {
+	policy = _policy
+}
+
+func (u *User) GetID() int {
+	return u.ID
+}
+
+func (u *User) validateUsername() error {
+
+	if !data.Valid(u.Username) {
+		return data.FieldValidationErrorNew("username", 1, "Username is required")
+	}
+
+	var count int64
+
+	db.Model(&User{}).Where("username = ? AND id != ?", u.Username, u.ID).Count(&count)
+
+	if count > 0 {
+		return data.FieldValidationErrorNew("username", 1, "Username is taken")
+	}
+
+	return nil
+}
+
+// validateGrants requires the roles and tenant to be kept as in old unless
+// changed by an admin, so users cannot grant themselves any.
+func (u *User) validateGrants(ctx context.Context, old *User) error {
+
+	if handler.IsAdmin(ctx) {
+		return nil
+	}
+
+	if len(u.Roles) != len(old.Roles) {
+		return data.FieldValidationErrorNew("roles", data.CodeReadOnly, "Roles can only be changed by an admin")
+	}
+
+	for i := range u.Roles {
+		if u.Roles[i] != old.Roles[i] {
+			return data.FieldValidationErrorNew("roles", data.CodeReadOnly, "Roles can only be changed by an admin")
+		}
+	}
+
+	if u.Tenant != old.Tenant {
+		return data.FieldValidationErrorNew("tenant", data.CodeReadOnly, "Tenant can only be changed by an admin")
+	}
+
+	return nil
+}
+
+// ValidateCreate requires an admin, a unique username and a password by the
+// policy.
+func (u *User) ValidateCreate(ctx context.Context) error {
+
+	if !handler.IsAdmin(ctx) {
+		return data.FieldValidationErrorNew("id_user", 1, "Users can only be created by an admin")
+	}
+
+	err := u.validateUsername()
+	if err != nil {
+		return err
+	}
+
+	err = u.validateGrants(ctx, &User{})
+	if err != nil {
+		return err
+	}
+
+	return policy.Check(u.Password)
+}
+
+// ValidateUpdate checks the password against the policy only when a new
+// one is given, keeping the hash of the old one otherwise, and against the
+// current one unless given by an admin. Only admins may change the roles
+// and tenant.
+func (u *User) ValidateUpdate(ctx context.Context, old *User) error {
+
+	err := u.validateUsername()
+	if err != nil {
+		return err
+	}
+
+	err = u.validateGrants(ctx, old)
+	if err != nil {
+		return err
+	}
+
+	if u.Password == "" {
+		return nil
+	}
+
+	if !handler.IsAdmin(ctx) {
+
+		if u.CurrentPassword == "" {
+			return data.FieldValidationErrorNew("current_password", 1, "Current password is required")
+		}
+
+		ok, err := Verify(u.CurrentPassword, old.PasswordHash)
+		if err != nil || !ok {
+			return data.FieldValidationErrorNew("current_password", 1, "Current password is wrong")
+		}
+	}
+
+	return policy.Check(u.Password)
+}
+
+// ValidateDelete requires an admin.
+func (u *User) ValidateDelete(ctx context.Context) error {
+
+	if !handler.IsAdmin(ctx) {
+		return data.FieldValidationErrorNew("id_user", 1, "Users can only be deleted by an admin")
+	}
+
+	return nil
+}
+
+// BeforeSave hashes the password given, if any.
+func (u *User) BeforeSave(tx *gorm.DB) error {
+
+	if u.Password == "" {
+		return nil
+	}
+
+	encoded, err := hasher.Hash(u.Password)
+	if err != nil {
+		return err
+	}
+
+	u.PasswordHash = encoded
+	u.Password = ""
+	u.CurrentPassword = ""
+
+	return nil
+}
+
+// Check tells whether password is the one of username, replacing its hash
+// when made by another algorithm or parameters than the current hasher.
+func Check(username string, password string) bool {
+
+	var user User
+
+	res := db.Where("username = ?", username).Limit(1).Find(&user)
+	if res.Error != nil || res.RowsAffected == 0 {
+		// hashed anyway, so unknown users take as long as wrong passwords
+		hasher.Hash(password)
+		return false
+	}
+
+	ok, err := Verify(password, user.PasswordHash)
+	if err != nil || !ok {
+		return false
+	}
+
+	if hasher.NeedsRehash(user.PasswordHash) {
+		if encoded, err := hasher.Hash(password); err == nil {
+			db.Model(&user).UpdateColumn("password_hash", encoded)
+		}
+	}
+
+	return true
+}
+
+// ClaimsFor returns the roles and tenant claims of username.
+func ClaimsFor(username string) map[string]any {
+
+	var user User
+
+	res := db.Where("username = ?", username).Limit(1).Find(&user)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil
+	}
+
+	return map[string]any{"roles": user.Roles, "tenant": user.Tenant}
+}
+
+// NewAuthenticator makes tokens authenticate the users and issue their
+// roles and tenant in the tokens.
+func NewAuthenticator(tokens *jwt.Authenticator) *jwt.Authenticator {
+
+	tokens.Check = Check
+	tokens.ClaimsFor = ClaimsFor
+
+	return tokens
+}
+
+// isSelf tells whether the session of r is the one of the user in the
+// id_user route var.
+func isSelf(r *http.Request) bool {
+
+	session, _ := handler.SessionFrom(r.Context())
+	if session.Identity == nil {
+		return false
+	}
+
+	var count int64
+
+	db.Model(&User{}).Where("id = ? AND username = ?", mux.Vars(r)["id_user"], session.Identity.UserID).Count(&count)
+
+	return count > 0
+}
+
+// The handlers managing the users, routed with an id_user var for a single
+// one. Users are created and deleted by admins, and updated by admins or
+// themselves.
+
+func List(w http.ResponseWriter, r *http.Request) {
+	handler.List[User](w, r)
+}
+
+func Create(w http.ResponseWriter, r *http.Request) {
+
+	if !handler.IsAdmin(r.Context()) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	handler.Create[*User](w, r)
+}
+
+func Retrieve(w http.ResponseWriter, r *http.Request) {
+	handler.Retrieve[User](w, r)
+}
+
+func Update(w http.ResponseWriter, r *http.Request) {
+
+	if !handler.IsAdmin(r.Context()) && !isSelf(r) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	handler.Update[*User](w, r)
+}
+
+func Delete(w http.ResponseWriter, r *http.Request) {
+
+	if !handler.IsAdmin(r.Context()) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	handler.Delete[*User](w, r)
+}
@@ -0,0 +1,340 @@
+package users
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/diogomattioli/crud/pkg/data"
+	"github.com/diogomattioli/crud/pkg/handler"
+	"github.com/diogomattioli/crud/pkg/jwt"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+var cheap = Argon2id{Time: 1, Memory: 64, Threads: 1, KeyLen: 16, SaltLen: 8}
+
+func setupDb() {
+
+	_db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		panic("failed to connect database")
+	}
+
+	_db.AutoMigrate(&User{})
+
+	handler.SetDatabase(_db)
+	SetDatabase(_db)
+	SetHasher(cheap)
+	SetPasswordPolicy(DefaultPolicy)
+}
+
+func destroyDb() {
+	db, err := db.DB()
+	if err == nil {
+		db.Close()
+	}
+}
+
+func serveHTTP(req *http.Request) *httptest.ResponseRecorder {
+
+	rec := httptest.NewRecorder()
+
+	router := mux.NewRouter().StrictSlash(true)
+	router.HandleFunc("/user/", List).Methods("GET")
+	router.HandleFunc("/user/", Create).Methods("POST")
+	router.HandleFunc("/user/{id_user:[0-9]+}", Retrieve).Methods("GET")
+	router.HandleFunc("/user/{id_user:[0-9]+}", Update).Methods("PATCH")
+	router.HandleFunc("/user/{id_user:[0-9]+}", Delete).Methods("DELETE")
+	router.ServeHTTP(rec, req)
+
+	return rec
+}
+
+// asAdmin makes req be made by an admin, as the Auth handler would.
+func asAdmin(req *http.Request) *http.Request {
+	return as(req, &data.Identity{UserID: "root", Roles: []string{"admin"}})
+}
+
+// as makes req be made by identity, as the Auth handler would.
+func as(req *http.Request, identity *data.Identity) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), handler.Session{}, handler.Session{Identity: identity}))
+}
+
+func createUser(t *testing.T, body string) *httptest.ResponseRecorder {
+
+	req, err := http.NewRequest("POST", "/user/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return serveHTTP(asAdmin(req))
+}
+
+func TestHash(t *testing.T) {
+
+	encoded, err := cheap.Hash("secret")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, strings.HasPrefix(encoded, "$argon2id$v=19$m=64,t=1,p=1$"))
+
+	ok, err := Verify("secret", encoded)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, ok)
+
+	ok, _ = Verify("other", encoded)
+	assert.Equal(t, false, ok)
+
+	assert.Equal(t, false, cheap.NeedsRehash(encoded))
+	assert.Equal(t, true, Argon2id{Time: 2, Memory: 64, Threads: 1, KeyLen: 16, SaltLen: 8}.NeedsRehash(encoded))
+
+	bcrypted, err := Bcrypt{Cost: 4}.Hash("secret")
+	assert.Equal(t, nil, err)
+
+	ok, err = Verify("secret", bcrypted)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, ok)
+
+	ok, err = Verify("other", bcrypted)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, ok)
+
+	assert.Equal(t, false, Bcrypt{Cost: 4}.NeedsRehash(bcrypted))
+	assert.Equal(t, true, Bcrypt{Cost: 5}.NeedsRehash(bcrypted))
+	assert.Equal(t, true, cheap.NeedsRehash(bcrypted))
+	assert.Equal(t, true, Bcrypt{Cost: 4}.NeedsRehash(encoded))
+
+	_, err = Verify("secret", "plain")
+	assert.Equal(t, ErrUnknownHash, err)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+
+	p := PasswordPolicy{MinLength: 8, MaxLength: 16, Upper: true, Digit: true, Symbol: true}
+
+	assert.Equal(t, nil, p.Check("Passw0rd!"))
+
+	err := p.Check("pass")
+	assert.Equal(t, data.FieldValidationErrorNew("password", data.CodeWeakPassword, "Password requires at least 8 characters, an uppercase letter, a digit, a symbol"), err)
+
+	err = p.Check("Passw0rd!Passw0rd!")
+	assert.Equal(t, data.FieldValidationErrorNew("password", data.CodeWeakPassword, "Password requires at most 16 characters"), err)
+}
+
+func TestCreate(t *testing.T) {
+
+	setupDb()
+	defer destroyDb()
+
+	rec := createUser(t, "{\"username\":\"ana\",\"password\":\"short\"}")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "{\"code\":1003,\"message\":\"Password requires at least 12 characters\",\"field\":\"password\"}", rec.Body.String())
+
+	rec = createUser(t, "{\"username\":\"ana\",\"password\":\"correct horse battery\",\"roles\":[\"admin\"],\"tenant\":\"acme\"}")
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	var user User
+	db.First(&user, 1)
+
+	assert.Equal(t, "", user.Password)
+	assert.Equal(t, []string{"admin"}, user.Roles)
+	assert.Equal(t, true, strings.HasPrefix(user.PasswordHash, "$argon2id$"))
+
+	rec = createUser(t, "{\"username\":\"ana\",\"password\":\"correct horse battery\"}")
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "{\"code\":1,\"message\":\"Username is taken\",\"field\":\"username\"}", rec.Body.String())
+
+	req, err := http.NewRequest("GET", "/user/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec = serveHTTP(req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var fields map[string]any
+	json.NewDecoder(rec.Body).Decode(&fields)
+
+	assert.Equal(t, "ana", fields["username"])
+	assert.NotContains(t, fields, "password")
+	assert.NotContains(t, fields, "PasswordHash")
+}
+
+func TestCheck(t *testing.T) {
+
+	setupDb()
+	defer destroyDb()
+
+	createUser(t, "{\"username\":\"ana\",\"password\":\"correct horse battery\"}")
+
+	assert.Equal(t, true, Check("ana", "correct horse battery"))
+	assert.Equal(t, false, Check("ana", "wrong horse battery"))
+	assert.Equal(t, false, Check("bob", "correct horse battery"))
+}
+
+func TestCheckRehash(t *testing.T) {
+
+	setupDb()
+	defer destroyDb()
+
+	SetHasher(Bcrypt{Cost: 4})
+
+	createUser(t, "{\"username\":\"ana\",\"password\":\"correct horse battery\"}")
+
+	var user User
+	db.First(&user, 1)
+
+	assert.Equal(t, true, strings.HasPrefix(user.PasswordHash, "$2a$04$"))
+
+	SetHasher(cheap)
+
+	assert.Equal(t, false, Check("ana", "wrong horse battery"))
+
+	db.First(&user, 1)
+	assert.Equal(t, true, strings.HasPrefix(user.PasswordHash, "$2a$04$"))
+
+	assert.Equal(t, true, Check("ana", "correct horse battery"))
+
+	db.First(&user, 1)
+	assert.Equal(t, true, strings.HasPrefix(user.PasswordHash, "$argon2id$"))
+
+	assert.Equal(t, true, Check("ana", "correct horse battery"))
+}
+
+func TestUpdatePassword(t *testing.T) {
+
+	setupDb()
+	defer destroyDb()
+
+	createUser(t, "{\"username\":\"ana\",\"password\":\"correct horse battery\"}")
+
+	req, err := http.NewRequest("PATCH", "/user/1", strings.NewReader("{\"tenant\":\"acme\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec := serveHTTP(asAdmin(req))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, true, Check("ana", "correct horse battery"))
+
+	req, err = http.NewRequest("PATCH", "/user/1", strings.NewReader("{\"password\":\"short\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec = serveHTTP(asAdmin(req))
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+
+	req, err = http.NewRequest("PATCH", "/user/1", strings.NewReader("{\"password\":\"staple battery horse\"}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	rec = serveHTTP(asAdmin(req))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, false, Check("ana", "correct horse battery"))
+	assert.Equal(t, true, Check("ana", "staple battery horse"))
+
+	var user User
+	db.First(&user, 1)
+
+	assert.Equal(t, "acme", user.Tenant)
+}
+
+func TestGrants(t *testing.T) {
+
+	setupDb()
+	defer destroyDb()
+
+	createUser(t, "{\"username\":\"ana\",\"password\":\"correct horse battery\",\"roles\":[\"editor\"],\"tenant\":\"acme\"}")
+	createUser(t, "{\"username\":\"bob\",\"password\":\"correct horse battery\"}")
+
+	ana := &data.Identity{UserID: "ana", Roles: []string{"editor"}, Tenant: "acme"}
+	admin := &data.Identity{UserID: "root", Roles: []string{"admin"}}
+
+	for _, test := range []struct {
+		identity *data.Identity
+		method   string
+		url      string
+		body     string
+		code     int
+		contains string
+	}{
+		{nil, "POST", "/user/", "{\"username\":\"eve\",\"password\":\"correct horse battery\"}", http.StatusForbidden, ""},
+		{ana, "POST", "/user/", "{\"username\":\"eve\",\"password\":\"correct horse battery\"}", http.StatusForbidden, ""},
+		{ana, "PATCH", "/user/1", "{\"roles\":[\"editor\",\"admin\"]}", http.StatusUnprocessableEntity, "{\"code\":1002,\"message\":\"Roles can only be changed by an admin\",\"field\":\"roles\"}"},
+		{ana, "PATCH", "/user/1", "{\"tenant\":\"other\"}", http.StatusUnprocessableEntity, "{\"code\":1002,\"message\":\"Tenant can only be changed by an admin\",\"field\":\"tenant\"}"},
+		{nil, "PATCH", "/user/1", "{\"password\":\"staple battery horse\"}", http.StatusForbidden, ""},
+		{ana, "PATCH", "/user/2", "{\"password\":\"staple battery horse\"}", http.StatusForbidden, ""},
+		{ana, "PATCH", "/user/1", "{\"password\":\"staple battery horse\"}", http.StatusUnprocessableEntity, "Current password is required"},
+		{ana, "PATCH", "/user/1", "{\"password\":\"staple battery horse\",\"current_password\":\"wrong\"}", http.StatusUnprocessableEntity, "Current password is wrong"},
+		{ana, "PATCH", "/user/1", "{\"password\":\"staple battery horse\",\"current_password\":\"correct horse battery\"}", http.StatusOK, ""},
+		{nil, "DELETE", "/user/2", "", http.StatusForbidden, ""},
+		{ana, "DELETE", "/user/1", "", http.StatusForbidden, ""},
+		{admin, "DELETE", "/user/2", "", http.StatusNoContent, ""},
+	} {
+
+		req, err := http.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+
+		if test.identity != nil {
+			req = as(req, test.identity)
+		}
+
+		rec := serveHTTP(req)
+
+		assert.Equal(t, test.code, rec.Code, test.body)
+		assert.Contains(t, rec.Body.String(), test.contains, test.body)
+	}
+
+	var user User
+	db.First(&user, 1)
+
+	assert.Equal(t, []string{"editor"}, user.Roles)
+	assert.Equal(t, "acme", user.Tenant)
+	assert.Equal(t, true, Check("ana", "staple battery horse"))
+	assert.Equal(t, false, Check("bob", "correct horse battery"))
+}
+
+func TestNewAuthenticator(t *testing.T) {
+
+	setupDb()
+	defer destroyDb()
+
+	createUser(t, "{\"username\":\"ana\",\"password\":\"correct horse battery\",\"roles\":[\"editor\"],\"tenant\":\"acme\"}")
+
+	a := NewAuthenticator(&jwt.Authenticator{Keys: []jwt.Key{jwt.HS256("", []byte("secret"))}})
+
+	assert.Equal(t, true, a.Authenticate("ana", "correct horse battery"))
+	assert.Equal(t, false, a.Authenticate("ana", "wrong"))
+
+	identity, ok := a.Identify(a.Create("ana"))
+
+	assert.Equal(t, true, ok)
+	assert.Equal(t, "ana", identity.UserID)
+	assert.Equal(t, []string{"editor"}, identity.Roles)
+	assert.Equal(t, "acme", identity.Tenant)
+}